@@ -0,0 +1,273 @@
+package extractor
+
+import (
+	"math"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+)
+
+const (
+	ARTICLE_SELECTOR     = "@article"
+	articleMinParagraph  = 25
+	articleClassWeight   = 25
+	articleLinkDensity   = 0.5
+	articleSiblingRatio  = 0.2
+	articleSiblingMinLen = 80
+)
+
+var (
+	articleRemove   = "script,style,noscript,iframe,form,nav,footer,aside,button,input,select,textarea,svg"
+	articleNegative = regexp.MustCompile(`(?i)comment|meta|footer|footnote|foot|nav|sidebar|sponsor|(^|[\s_-])ad-|advert|share|social|related|recommend|menu|breadcrumb|banner|popup|combx|masthead|tags|widget`)
+	articlePositive = regexp.MustCompile(`(?i)article|body|content|entry|main|page|post|text|blog|story`)
+	titleSeparator  = regexp.MustCompile(`\s+[-|_–—]\s+`)
+)
+
+func classWeight(s *goquery.Selection) float64 {
+	weight := 0.0
+	for _, attr := range []string{"class", "id"} {
+		v := s.AttrOr(attr, "")
+		if len(v) == 0 {
+			continue
+		}
+		if articleNegative.MatchString(v) {
+			weight -= articleClassWeight
+		}
+		if articlePositive.MatchString(v) {
+			weight += articleClassWeight
+		}
+	}
+	return weight
+}
+
+func tagWeight(name string) float64 {
+	switch name {
+	case "article":
+		return 10
+	case "div", "section", "main":
+		return 5
+	case "pre", "td", "blockquote":
+		return 3
+	case "ol", "ul", "dl", "dd", "dt", "li", "form":
+		return -3
+	case "h1", "h2", "h3", "h4", "h5", "h6", "th":
+		return -5
+	}
+	return 0
+}
+
+func linkDensity(s *goquery.Selection) float64 {
+	text := len([]rune(normalizeSpace(s.Text())))
+	if text == 0 {
+		return 0
+	}
+	links := 0
+	s.Find("a").Each(func(i int, a *goquery.Selection) {
+		links += len([]rune(normalizeSpace(a.Text())))
+	})
+	return float64(links) / float64(text)
+}
+
+// articleContent scores the blocks of a cleaned document by the paragraphs
+// they hold, readability style, and returns the best one.
+func articleContent(body *goquery.Selection) *goquery.Selection {
+	scores := map[*html.Node]float64{}
+	candidates := []*html.Node{}
+	addScore := func(n *html.Node, score float64) {
+		if n == nil || n.Type != html.ElementNode {
+			return
+		}
+		if _, ok := scores[n]; !ok {
+			s := goquery.NewDocumentFromNode(n).Selection
+			scores[n] = tagWeight(n.Data) + classWeight(s)
+			candidates = append(candidates, n)
+		}
+		scores[n] += score
+	}
+	body.Find("p,pre,blockquote,td").Each(func(i int, p *goquery.Selection) {
+		text := normalizeSpace(p.Text())
+		length := len([]rune(text))
+		if length < articleMinParagraph {
+			return
+		}
+		score := 1 + float64(strings.Count(text, ",")+strings.Count(text, "，")+strings.Count(text, "。"))
+		score += math.Min(float64(length)/100, 3)
+		parent := p.Get(0).Parent
+		addScore(parent, score)
+		if parent != nil {
+			addScore(parent.Parent, score/2)
+		}
+	})
+
+	var top *html.Node
+	topScore := 0.0
+	for _, n := range candidates {
+		score := scores[n] * (1 - linkDensity(goquery.NewDocumentFromNode(n).Selection))
+		scores[n] = score
+		if top == nil || score > topScore {
+			top, topScore = n, score
+		}
+	}
+	if top == nil {
+		return body
+	}
+
+	content := goquery.NewDocumentFromNode(top).Selection
+	if top.Parent == nil {
+		return content
+	}
+	// keep siblings that score well or read like paragraphs of the article
+	threshold := math.Max(10, topScore*articleSiblingRatio)
+	ret := content
+	for c := top.Parent.FirstChild; c != nil; c = c.NextSibling {
+		if c == top || c.Type != html.ElementNode {
+			continue
+		}
+		sibling := goquery.NewDocumentFromNode(c).Selection
+		if score, ok := scores[c]; ok && score >= threshold {
+			ret = ret.AddSelection(sibling)
+		} else if c.Data == "p" && len([]rune(normalizeSpace(sibling.Text()))) >= articleSiblingMinLen && linkDensity(sibling) < 0.25 {
+			ret = ret.AddSelection(sibling)
+		}
+	}
+	return ret
+}
+
+func cleanArticle(s *goquery.Selection) {
+	s.Find(articleRemove).Remove()
+	s.Find("*").Each(func(i int, e *goquery.Selection) {
+		if classWeight(e) < 0 && goquery.NodeName(e) != "body" {
+			e.Remove()
+		}
+	})
+}
+
+func cleanContent(content *goquery.Selection) {
+	content.Find("div,ul,ol,table,section").Each(func(i int, e *goquery.Selection) {
+		if len([]rune(normalizeSpace(e.Text()))) < articleMinParagraph*4 && linkDensity(e) > articleLinkDensity {
+			e.Remove()
+		}
+	})
+	content.Find("p").Each(func(i int, p *goquery.Selection) {
+		if len(normalizeSpace(p.Text())) == 0 && p.Find("img").Size() == 0 {
+			p.Remove()
+		}
+	})
+}
+
+func firstAttr(s *goquery.Selection, selectors []string, attrs ...string) string {
+	for _, selector := range selectors {
+		found := s.Find(selector).First()
+		if found.Size() == 0 {
+			continue
+		}
+		for _, attr := range attrs {
+			if v, ok := found.Attr(attr); ok && len(strings.TrimSpace(v)) > 0 {
+				return strings.TrimSpace(v)
+			}
+		}
+		if text := normalizeSpace(found.Text()); len(text) > 0 {
+			return text
+		}
+	}
+	return ""
+}
+
+func articleTitle(s *goquery.Selection) string {
+	if title := firstAttr(s, []string{`meta[property="og:title"]`}, "content"); len(title) > 0 {
+		return title
+	}
+	if h1 := s.Find("h1"); h1.Size() == 1 {
+		return normalizeSpace(h1.Text())
+	}
+	title := normalizeSpace(s.Find("title").First().Text())
+	if loc := titleSeparator.FindAllStringIndex(title, -1); len(loc) > 0 {
+		head := title[:loc[len(loc)-1][0]]
+		if len([]rune(head)) >= 5 {
+			return head
+		}
+	}
+	return title
+}
+
+func paragraphText(content *goquery.Selection) string {
+	lines := []string{}
+	blocks := content.Find("p,h1,h2,h3,h4,h5,h6,li,pre,blockquote")
+	if blocks.Size() == 0 {
+		return normalizeSpace(content.Text())
+	}
+	blocks.Each(func(i int, b *goquery.Selection) {
+		if b.ParentsFiltered("p,li,pre,blockquote").Size() > 0 {
+			return
+		}
+		if text := normalizeSpace(b.Text()); len(text) > 0 {
+			lines = append(lines, text)
+		}
+	})
+	return strings.Join(lines, "\n")
+}
+
+// Article finds the main content of a news or forum page and returns its
+// title, byline, published time, cleaned html, plain text and lead image.
+// The page itself is not modified.
+func (self *Extractor) Article(s *goquery.Selection) map[string]interface{} {
+	root := s
+	if s.Parents().Size() > 0 {
+		root = s.Parents().Last()
+	}
+	ret := map[string]interface{}{
+		"title": nilIfEmpty(articleTitle(root)),
+		"byline": nilIfEmpty(firstAttr(root, []string{
+			`meta[name="author"]`, `[rel="author"]`, `[itemprop="author"]`, `.byline`, `.author`,
+		}, "content")),
+		"published": nilIfEmpty(firstAttr(root, []string{
+			`meta[property="article:published_time"]`, `[itemprop="datePublished"]`,
+			`meta[name="pubdate"]`, `meta[name="publishdate"]`, `time[datetime]`,
+		}, "content", "datetime")),
+	}
+
+	clone := s.Clone()
+	cleanArticle(clone)
+	content := articleContent(clone)
+	cleanContent(content)
+	htmls := []string{}
+	content.Each(func(i int, c *goquery.Selection) {
+		if h, err := goquery.OuterHtml(c); err == nil {
+			htmls = append(htmls, h)
+		}
+	})
+	ret["html"] = nilIfEmpty(strings.Join(htmls, "\n"))
+	texts := []string{}
+	content.Each(func(i int, c *goquery.Selection) {
+		if text := paragraphText(c); len(text) > 0 {
+			texts = append(texts, text)
+		}
+	})
+	ret["text"] = nilIfEmpty(strings.Join(texts, "\n"))
+
+	image := firstAttr(root, []string{`meta[property="og:image"]`}, "content")
+	if len(image) == 0 {
+		image = imageCandidate(imgPriority, content.Find("img").First())
+	}
+	ret["image"] = nilIfEmpty(self.absURL(image))
+	return ret
+}
+
+// extractArticle handles "@article" and "@article;key" where key is one of
+// the fields returned by Article, text by default.
+func (self *Extractor) extractArticle(v string, s *goquery.Selection) interface{} {
+	key := "text"
+	if tks := strings.SplitN(v, ";", 2); len(tks) > 1 && len(tks[1]) > 0 {
+		key = tks[1]
+	}
+	article := self.Article(s)
+	val, ok := article[key]
+	if !ok || val == nil {
+		self.traceSelector(v, 0)
+		return nil
+	}
+	self.traceSelector(v, 1)
+	return val
+}
@@ -0,0 +1,77 @@
+package extractor
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+var articlePage = []byte(`<html><head>
+	<title>Extractor 1.0 released - Example News</title>
+	<meta name="author" content="Li Lei">
+	<meta property="article:published_time" content="2026-10-19T08:00:00Z">
+	</head><body>
+	<div class="nav"><a href="/">Home</a> <a href="/tech">Tech</a> <a href="/finance">Finance</a></div>
+	<div id="main">
+		<div class="post-content">
+			<h1>Extractor 1.0 released</h1>
+			<p>The extractor team released version 1.0 today, bringing table extraction, label pairs, and structured metadata to every config.</p>
+			<p><img src="//img.example.com/lead.jpg"></p>
+			<p>Users can now describe pages with fewer selectors, and the new trace mode shows how every field was resolved, step by step.</p>
+			<div class="share"><a href="/s/wechat">WeChat</a> <a href="/s/weibo">Weibo</a></div>
+		</div>
+		<div class="comments"><p>Great work, this saves us a lot of time every single week, thanks a lot!</p></div>
+	</div>
+	<div class="sidebar"><ul><li><a href="/a">Another story</a></li><li><a href="/b">Yet another story</a></li></ul></div>
+	</body></html>`)
+
+func TestArticle(t *testing.T) {
+	config := `{"_type":"article"}`
+	m := map[string]interface{}{}
+	json.Unmarshal([]byte(config), &m)
+	ret := NewExtractor().Do(m, articlePage).(map[string]interface{})
+	if ret["title"] != "Extractor 1.0 released" || ret["byline"] != "Li Lei" || ret["published"] != "2026-10-19T08:00:00Z" {
+		t.Error(ret)
+	}
+	if ret["image"] != "https://img.example.com/lead.jpg" {
+		t.Error(ret["image"])
+	}
+	text := ret["text"].(string)
+	if !strings.Contains(text, "version 1.0 today") || !strings.Contains(text, "trace mode") ||
+		strings.Contains(text, "Great work") || strings.Contains(text, "WeChat") || strings.Contains(text, "Finance") {
+		t.Error(text)
+	}
+	t.Log(text)
+}
+
+func TestArticleSelector(t *testing.T) {
+	config := `{"title":"h1", "body":"@article", "byline":"@article;byline"}`
+	m := map[string]interface{}{}
+	json.Unmarshal([]byte(config), &m)
+	ret := NewExtractor().Do(m, articlePage).(map[string]interface{})
+	if ret["title"] != "Extractor 1.0 released" || ret["byline"] != "Li Lei" || !strings.Contains(ret["body"].(string), "trace mode") {
+		t.Error(ret)
+	}
+}
+
+func TestClassWeight(t *testing.T) {
+	cases := map[string]float64{
+		`<div class="ad-banner">`:      -articleClassWeight,
+		`<div class="top ad-slot">`:    -articleClassWeight,
+		`<div class="top_ad-box">`:     -articleClassWeight,
+		`<div class="head-ad-box">`:    -articleClassWeight,
+		`<div class="thread-content">`: articleClassWeight,
+		`<div class="download-area">`:  0,
+		`<div class="lead-box">`:       0,
+		`<div class="upload-ad-hoc">`:  -articleClassWeight,
+		`<div class="read-more">`:      0,
+	}
+	for page, weight := range cases {
+		doc, _ := goquery.NewDocumentFromReader(strings.NewReader(page))
+		if w := classWeight(doc.Find("div")); w != weight {
+			t.Errorf("%s: %v", page, w)
+		}
+	}
+}
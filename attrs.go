@@ -0,0 +1,94 @@
+package extractor
+
+import (
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+)
+
+// structuredModes are the attribute modes whose value is a map or an array
+// rather than a string, so regex and template do not apply to them.
+var structuredModes = map[string]bool{
+	"@attrs":    true,
+	"dataset":   true,
+	"classes":   true,
+	"textnodes": true,
+}
+
+// structuredValue returns the value of node for one of the structured
+// attribute modes, or nil when node is empty.
+func structuredValue(mode string, node *goquery.Selection) interface{} {
+	if node.Size() == 0 {
+		return nil
+	}
+	n := node.Get(0)
+	switch mode {
+	case "@attrs":
+		ret := map[string]string{}
+		for _, attr := range n.Attr {
+			ret[attr.Key] = attr.Val
+		}
+		return ret
+	case "dataset":
+		ret := map[string]string{}
+		for _, attr := range n.Attr {
+			if strings.HasPrefix(attr.Key, "data-") {
+				ret[camelCase(attr.Key[len("data-"):])] = attr.Val
+			}
+		}
+		return ret
+	case "classes":
+		return strings.Fields(nodeAttr(n, "class"))
+	case "textnodes":
+		ret := []string{}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type != html.TextNode {
+				continue
+			}
+			if text := strings.TrimSpace(c.Data); len(text) > 0 {
+				ret = append(ret, text)
+			}
+		}
+		return ret
+	}
+	return nil
+}
+
+// camelCase turns the name of a data-* attribute into its dataset key the
+// way browsers do, e.g. sku-id into skuId.
+func camelCase(name string) string {
+	var buf strings.Builder
+	for i := 0; i < len(name); i++ {
+		if name[i] == '-' && i+1 < len(name) && name[i+1] >= 'a' && name[i+1] <= 'z' {
+			buf.WriteByte(name[i+1] - 'a' + 'A')
+			i++
+			continue
+		}
+		buf.WriteByte(name[i])
+	}
+	return buf.String()
+}
+
+// commentText returns the trimmed content of the first html comment inside
+// node, where some sites hide data from the rendered page.
+func commentText(node *goquery.Selection) string {
+	for _, n := range node.Nodes {
+		if text, ok := firstComment(n); ok {
+			return text
+		}
+	}
+	return ""
+}
+
+func firstComment(n *html.Node) (string, bool) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.CommentNode {
+			return strings.TrimSpace(c.Data), true
+		}
+		if text, ok := firstComment(c); ok {
+			return text, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,35 @@
+package extractor
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestAttributeModes(t *testing.T) {
+	body := []byte(`<html><body>
+		<div id="sku" class="item  hot" data-sku-id="1001" data-price="9.90" data-X="y">
+			Apple <b>fresh</b> fruit
+			<!-- {"stock": 12} -->
+		</div>
+		<ul><li class="a">1</li><li class="b c">2</li></ul>
+		</body></html>`)
+	config := `{
+		"attrs":"#sku;@attrs",
+		"dataset":"#sku;dataset",
+		"classes":"#sku;classes",
+		"own":"#sku;owntext",
+		"nodes":"#sku;textnodes",
+		"outer":"b;outerhtml",
+		"stock":"#sku;comment;\"stock\": (\\d+)",
+		"lists":"li@all;classes",
+		"missing":"#none;comment"
+	}`
+	m := map[string]interface{}{}
+	json.Unmarshal([]byte(config), &m)
+	ret := NewExtractor().Do(m, body)
+	out, _ := json.Marshal(ret)
+	expected := `{"attrs":{"class":"item  hot","data-price":"9.90","data-sku-id":"1001","data-x":"y","id":"sku"},"classes":["item","hot"],"dataset":{"price":"9.90","skuId":"1001","x":"y"},"lists":[["a"],["b","c"]],"missing":null,"nodes":["Apple","fruit"],"outer":"\u003cb\u003efresh\u003c/b\u003e","own":"Apple fruit","stock":"12"}`
+	if string(out) != expected {
+		t.Error(string(out))
+	}
+}
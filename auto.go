@@ -0,0 +1,179 @@
+package extractor
+
+import (
+	"bytes"
+	"errors"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+)
+
+const (
+	AUTO_ROOT        = "@auto"
+	autoMinRecords   = 3
+	autoTextCap      = 200
+	autoPriceRegex   = `([\d.,]+)`
+	autoPriceMaxText = 30
+)
+
+var (
+	priceRegex = regexp.MustCompile(`^\D{0,4}[¥$€£￥]\s*\d[\d,]*(\.\d+)?|^\d[\d,]*\.\d{2}\s*(元|円)?$`)
+	autoSkip   = map[string]bool{
+		"script": true, "style": true, "option": true, "br": true, "meta": true,
+		"link": true, "head": true, "noscript": true, "svg": true, "path": true,
+	}
+)
+
+func signature(n *html.Node) string {
+	classes := stableClasses(n)
+	sort.Strings(classes)
+	part := n.Data
+	for _, class := range classes {
+		part += "." + class
+	}
+	return part
+}
+
+type recordGroup struct {
+	parent *html.Node
+	sig    string
+	nodes  []*html.Node
+	score  float64
+}
+
+func scoreGroup(group *recordGroup) float64 {
+	score := 0.0
+	for _, n := range group.nodes {
+		s := goquery.NewDocumentFromNode(n).Selection
+		text := len([]rune(normalizeSpace(s.Text())))
+		if text > autoTextCap {
+			text = autoTextCap
+		}
+		score += float64(text)
+		if s.Find("a[href]").Size() > 0 {
+			score += 20
+		}
+		if s.Find("img").Size() > 0 {
+			score += 20
+		}
+	}
+	return score
+}
+
+// detectRecords finds the dominant repeated structure below s: the largest
+// group of siblings sharing tag and stable classes, weighted by content.
+func detectRecords(s *goquery.Selection) *recordGroup {
+	var best *recordGroup
+	s.AddSelection(s.Find("*")).Each(func(i int, p *goquery.Selection) {
+		groups := map[string]*recordGroup{}
+		order := []string{}
+		for c := p.Get(0).FirstChild; c != nil; c = c.NextSibling {
+			if c.Type != html.ElementNode || autoSkip[c.Data] {
+				continue
+			}
+			sig := signature(c)
+			group, ok := groups[sig]
+			if !ok {
+				group = &recordGroup{parent: p.Get(0), sig: sig}
+				groups[sig] = group
+				order = append(order, sig)
+			}
+			group.nodes = append(group.nodes, c)
+		}
+		for _, sig := range order {
+			group := groups[sig]
+			if len(group.nodes) < autoMinRecords {
+				continue
+			}
+			group.score = scoreGroup(group)
+			if best == nil || group.score > best.score {
+				best = group
+			}
+		}
+	})
+	return best
+}
+
+// priceField finds the innermost element of a record whose own text looks
+// like a price.
+func priceField(record *goquery.Selection) string {
+	var price *html.Node
+	record.AddSelection(record.Find("*")).Each(func(i int, s *goquery.Selection) {
+		text := normalizeSpace(s.Text())
+		if len(text) > 0 && len(text) <= autoPriceMaxText && priceRegex.MatchString(text) {
+			if price == nil || isAncestor(price, s.Get(0)) {
+				price = s.Get(0)
+			}
+		}
+	})
+	if price == nil {
+		return ""
+	}
+	return cssPath(record, price) + ";;" + autoPriceRegex
+}
+
+// autoConfig infers the config of the dominant record list below s. The
+// non-underscore keys of base are kept and take precedence over the
+// inferred fields.
+func (self *Extractor) autoConfig(s *goquery.Selection, base map[string]interface{}) map[string]interface{} {
+	group := detectRecords(s)
+	if group == nil {
+		return nil
+	}
+	root := group.sig
+	if parent := cssPath(s, group.parent); len(parent) > 0 && !strings.Contains(parent, "@index") {
+		root = parent + " > " + group.sig
+	}
+	config := map[string]interface{}{ROOT_DEFINE: root + "@array"}
+	for key, val := range base {
+		if key != ROOT_DEFINE {
+			config[key] = val
+		}
+	}
+	if !isEmptyParse(base) {
+		return config
+	}
+
+	fields := map[string]string{"text": ""}
+	for _, n := range group.nodes {
+		record := goquery.NewDocumentFromNode(n).Selection
+		if _, ok := fields["link"]; !ok && record.Find("a[href]").Size() > 0 {
+			fields["link"] = "a;href"
+			fields["title"] = "a"
+		}
+		if _, ok := fields["image"]; !ok && record.Find("img").Size() > 0 {
+			fields["image"] = "img;src"
+		}
+		if _, ok := fields["price"]; !ok {
+			if price := priceField(record); len(price) > 0 {
+				fields["price"] = price
+			}
+		}
+	}
+	for key, val := range fields {
+		config[key] = val
+	}
+	return config
+}
+
+// AutoExtract extracts the dominant record list of an html page without a
+// config. It returns the records together with the inferred config, which
+// can be edited and passed to Do.
+func (self *Extractor) AutoExtract(body []byte) ([]map[string]interface{}, map[string]interface{}, error) {
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+	// extract tracks the record under extraction, so it runs on a copy
+	ex := *self
+	ex.scope = nil
+	config := ex.autoConfig(doc.First(), map[string]interface{}{})
+	if config == nil {
+		return nil, nil, errors.New("no repeated structure found")
+	}
+	records, _ := ex.extract(config, doc.First()).([]map[string]interface{})
+	return records, config, nil
+}
@@ -0,0 +1,52 @@
+package extractor
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+)
+
+var autoPage = []byte(`<html><body>
+	<div class="nav"><a href="/">home</a><a href="/help">help</a></div>
+	<div class="grid">
+		<div class="goods"><a href="/p/1"><img src="1.jpg">Phone</a><span class="price">¥199.00</span></div>
+		<div class="goods"><a href="/p/2"><img src="2.jpg">Tablet</a><span class="price">¥299.00</span></div>
+		<div class="goods"><a href="/p/3"><img src="3.jpg">Laptop</a><span class="price">¥1,999.00</span></div>
+	</div>
+	</body></html>`)
+
+func TestAutoExtract(t *testing.T) {
+	records, config, err := NewExtractor().AutoExtract(autoPage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Log(config)
+	if len(records) != 3 || records[2]["title"] != "Laptop" || records[2]["price"] != "1,999.00" || records[0]["image"] != "1.jpg" {
+		t.Error(records)
+	}
+}
+
+func TestAutoRoot(t *testing.T) {
+	config := `{"_root":"@auto", "name":"a"}`
+	m := map[string]interface{}{}
+	json.Unmarshal([]byte(config), &m)
+	ret := NewExtractor().Do(m, autoPage).([]map[string]interface{})
+	if len(ret) != 3 || ret[1]["name"] != "Tablet" || len(ret[1]) != 1 {
+		t.Error(ret)
+	}
+}
+
+func TestAutoExtractConcurrent(t *testing.T) {
+	extractor := NewExtractor()
+	wg := sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if records, _, err := extractor.AutoExtract(autoPage); err != nil || len(records) != 3 {
+				t.Error(records, err)
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,169 @@
+package extractor
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/xlvector/dlog"
+)
+
+// recordScope is a record under extraction, as seen by the expressions of
+// its _computed section. Computed fields are evaluated on first use so they
+// can refer to each other in any order.
+type recordScope struct {
+	record   map[string]interface{}
+	computed map[string]interface{}
+	done     map[string]bool
+	busy     map[string]bool
+	parent   *recordScope
+	vars     map[string]string
+	exprs    map[string]*exprNode
+}
+
+func (s *recordScope) field(name string) interface{} {
+	if name == "parent" {
+		if _, ok := s.record[name]; !ok && s.parent != nil {
+			return s.parent
+		}
+	}
+	if _, ok := s.computed[name]; ok && !s.done[name] {
+		s.compute(name)
+	}
+	return s.record[name]
+}
+
+func (s *recordScope) variable(name string) interface{} {
+	if val, ok := s.vars[name]; ok {
+		return val
+	}
+	return nil
+}
+
+// compute evaluates one computed field into the record. A field that
+// refers back to itself, or whose expression does not parse, is null.
+// Expressions are parsed once per config by compileComputed.
+func (s *recordScope) compute(name string) {
+	if s.busy[name] {
+		dlog.Warn("_computed %s refers to itself", name)
+		return
+	}
+	s.busy[name] = true
+	defer delete(s.busy, name)
+	var val interface{}
+	if src, ok := s.computed[name].(string); ok {
+		node := s.exprs[src]
+		var err error
+		if node == nil {
+			node, err = parseExpr(src)
+		}
+		if err != nil {
+			dlog.Warn("_computed %s: %s", name, err.Error())
+		} else {
+			val = node.eval(s)
+		}
+	} else {
+		val = s.computed[name]
+	}
+	s.record[name] = val
+	s.done[name] = true
+}
+
+// enterRecord makes record the current record for _computed and parent
+// references until the returned func is called.
+func (self *Extractor) enterRecord(m map[string]interface{}, record map[string]interface{}) func() {
+	computed, _ := m[COMPUTED_DEFINE].(map[string]interface{})
+	parent := self.scope
+	self.scope = &recordScope{
+		record:   record,
+		computed: computed,
+		done:     map[string]bool{},
+		busy:     map[string]bool{},
+		parent:   parent,
+		vars:     self.Vars,
+		exprs:    self.exprs,
+	}
+	return func() {
+		self.scope = parent
+	}
+}
+
+// compileComputed parses the _computed expressions of config and its nested
+// records into exprs, keyed by their source. It returns the first one that
+// does not parse.
+func compileComputed(config interface{}, exprs map[string]*exprNode) error {
+	switch c := config.(type) {
+	case map[string]interface{}:
+		computed, _ := c[COMPUTED_DEFINE].(map[string]interface{})
+		for name, v := range computed {
+			src, ok := v.(string)
+			if !ok || exprs[src] != nil {
+				continue
+			}
+			node, err := parseExpr(src)
+			if err != nil {
+				return fmt.Errorf("_computed %s: %w", name, err)
+			}
+			exprs[src] = node
+		}
+		for key, v := range c {
+			if key == COMPUTED_DEFINE {
+				continue
+			}
+			if err := compileComputed(v, exprs); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, v := range c {
+			if err := compileComputed(v, exprs); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// computeFields evaluates the _computed section of the current record,
+// after its regular fields.
+func (self *Extractor) computeFields() {
+	s := self.scope
+	if s == nil || len(s.computed) == 0 {
+		return
+	}
+	names := make([]string, 0, len(s.computed))
+	for name := range s.computed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if s.done[name] {
+			continue
+		}
+		leave := self.traceEnter(name)
+		s.compute(name)
+		self.traceValue(s.record[name])
+		leave()
+	}
+}
+
+// nestedLast orders the keys of a record config so plain fields are
+// extracted before nested records, which can then read them as parent.x.
+func nestedLast(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	sort.SliceStable(keys, func(i, j int) bool {
+		return !isNested(m[keys[i]]) && isNested(m[keys[j]])
+	})
+	return keys
+}
+
+func isNested(v interface{}) bool {
+	switch v.(type) {
+	case map[string]interface{}, []interface{}:
+		return true
+	}
+	return false
+}
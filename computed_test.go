@@ -0,0 +1,155 @@
+package extractor
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+type testEnv map[string]interface{}
+
+func (e testEnv) field(name string) interface{} {
+	return e[name]
+}
+
+func (e testEnv) variable(name string) interface{} {
+	return e["$"+name]
+}
+
+func TestExpr(t *testing.T) {
+	env := testEnv{"price": "¥12.50", "qty": "3", "name": " Apple ", "tags": []interface{}{"a", "b"}, "$city": "上海"}
+	cases := map[string]interface{}{
+		`price * qty`:                         37.5,
+		`round(price * qty / 7, 2)`:           5.36,
+		`concat(upper(trim(name)), "-", qty)`: "APPLE-3",
+		`"n=" + qty`:                          "n=3",
+		`qty + 1`:                             float64(4),
+		`missing * 2`:                         nil,
+		`missing ?? "none"`:                   "none",
+		`qty > 2 ? "many" : "few"`:            "many",
+		`qty == 3 && !(price < 10)`:           true,
+		`len(tags) + len("上海")`:               float64(4),
+		`tags[-1]`:                            "b",
+		`$city`:                               "上海",
+		`substr("abcdef", 1, 3)`:              "bcd",
+		`regex("sku-1024", "(\\d+)")`:         "1024",
+		`max(1, qty, "2") - min(tags, 5)`:     float64(-2),
+		`10 % 4 / 0`:                          nil,
+		`join(split("a,b", ","), "|")`:        "a|b",
+		`if(contains(tags, "b"), 1, 2)`:       float64(1),
+	}
+	for src, want := range cases {
+		node, err := parseExpr(src)
+		if err != nil {
+			t.Errorf("%s: %v", src, err)
+			continue
+		}
+		got := node.eval(env)
+		if got != want {
+			t.Errorf("%s: %#v, want %#v", src, got, want)
+		}
+	}
+}
+
+func TestExprErrors(t *testing.T) {
+	cases := map[string]int{
+		`price *`:      8,
+		`concat(a, b`:  12,
+		`system("rm")`: 1,
+		`a ? b`:        6,
+		`"abc`:         1,
+		`price # 2`:    7,
+	}
+	for src, col := range cases {
+		_, err := parseExpr(src)
+		var exprErr *ExprError
+		if !errors.As(err, &exprErr) || exprErr.Col != col || !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("%s: %v", src, err)
+		}
+	}
+}
+
+func TestComputed(t *testing.T) {
+	body := []byte(`<html><body><div class="shop" data-id="S01"><h1>Fruit</h1>
+		<ul>
+		<li data-sku="1"><span class="price">¥2.50</span><span class="qty">4</span></li>
+		<li data-sku="2"><span class="price">¥10.00</span><span class="qty"></span></li>
+		</ul></div></body></html>`)
+	config := `{
+		"_root":"div.shop",
+		"shop":"h1",
+		"_computed":{"count":"len(items)", "total":"items[0].total + items[1].total", "label":"concat(shop, \"@\", $city)"},
+		"items":{
+			"_root":"li@array",
+			"sku":";data-sku",
+			"price":"span.price",
+			"qty":"span.qty",
+			"_computed":{"id":"concat(parent.shop, \"-\", sku)", "total":"price * (qty ?? 1)", "status":"total >= 10 ? \"big\" : \"small\""}
+		}
+	}`
+	m := map[string]interface{}{}
+	json.Unmarshal([]byte(config), &m)
+	extractor := NewExtractor()
+	extractor.Vars = map[string]string{"city": "上海"}
+	out, _ := json.Marshal(extractor.Do(m, body))
+	expected := `{"count":2,"items":[{"id":"Fruit-1","price":"¥2.50","qty":"4","sku":"1","status":"big","total":10},{"id":"Fruit-2","price":"¥10.00","qty":null,"sku":"2","status":"big","total":10}],"label":"Fruit@上海","shop":"Fruit","total":20}`
+	if string(out) != expected {
+		t.Error(string(out))
+	}
+
+	config = `{"_type":"json", "_root":"list", "_computed":{"amount":"round(number(cents) / 100, 2)", "a":"b", "b":"a"}, "cents":"cents"}`
+	m = map[string]interface{}{}
+	json.Unmarshal([]byte(config), &m)
+	out, _ = json.Marshal(NewExtractor().Do(m, []byte(`{"list":[{"cents":1999}]}`)))
+	if string(out) != `[{"a":null,"amount":19.99,"b":null,"cents":"1999"}]` {
+		t.Error(string(out))
+	}
+}
+
+func TestComputedInvalid(t *testing.T) {
+	for _, config := range []string{
+		`{"name":"h1", "_computed":{"total":"price *"}}`,
+		`{"items":{"_root":"li@array", "_computed":{"id":"concat(sku"}}}`,
+		`{"_type":"json", "_root":"list", "_computed":{"x":"system(\"rm\")"}, "cents":"cents"}`,
+	} {
+		m := map[string]interface{}{}
+		json.Unmarshal([]byte(config), &m)
+		_, err := NewExtractor().Parse(m, []byte(`<h1>a</h1>`))
+		var exprErr *ExprError
+		if !errors.As(err, &exprErr) || !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("%s: %v", config, err)
+		}
+	}
+}
+
+func TestExprNonFinite(t *testing.T) {
+	env := testEnv{"price": "12.5", "big": "1" + strings.Repeat("0", 308)}
+	cases := map[string]interface{}{
+		`round(price, 400)`:   12.5,
+		`round(price, -400)`:  float64(0),
+		`round(big, 10)`:      1e308,
+		`big * 10`:            nil,
+		`big * 10 - big * 10`: nil,
+		`-big - big`:          nil,
+		`abs(big * 10)`:       nil,
+		`big % 0`:             nil,
+	}
+	for src, want := range cases {
+		node, err := parseExpr(src)
+		if err != nil {
+			t.Errorf("%s: %v", src, err)
+			continue
+		}
+		got := node.eval(env)
+		if got != want {
+			t.Errorf("%s: %#v, want %#v", src, got, want)
+		}
+	}
+
+	m := map[string]interface{}{"n": "h1", "_computed": map[string]interface{}{"x": "n * n", "y": "round(n, 999)"}}
+	ret, err := NewExtractor().Parse(m, []byte("<h1>"+strings.Repeat("9", 308)+"</h1>"))
+	if _, jerr := json.Marshal(ret); err != nil || jerr != nil {
+		t.Error(ret, err, jerr)
+	}
+}
@@ -0,0 +1,390 @@
+package extractor
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WalkFields calls fn for every leaf field of an extraction result. Fields
+// are named by their path, elements of record arrays collapse into [*], e.g.
+// items[*].price.
+func WalkFields(path string, v interface{}, fn func(path string, v interface{})) {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for key, sub := range val {
+			WalkFields(strings.TrimPrefix(path+"."+key, "."), sub, fn)
+		}
+		return
+	case []map[string]interface{}:
+		if len(val) > 0 {
+			for _, sub := range val {
+				WalkFields(path+"[*]", sub, fn)
+			}
+			return
+		}
+	case []interface{}:
+		if len(val) > 0 {
+			if _, ok := val[0].(map[string]interface{}); ok {
+				for _, sub := range val {
+					WalkFields(path+"[*]", sub, fn)
+				}
+				return
+			}
+		}
+	}
+	if path == "" {
+		path = "$"
+	}
+	fn(path, v)
+}
+
+func valueType(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		if len(val) == 0 {
+			return "empty"
+		}
+		if _, err := strconv.ParseFloat(val, 64); err == nil {
+			return "number"
+		}
+		return "string"
+	case float64, int, int64:
+		return "number"
+	case bool:
+		return "bool"
+	case []string, []interface{}, []map[string]interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return "other"
+}
+
+type FieldStats struct {
+	Count     int            `json:"count"`
+	Filled    int            `json:"filled"`
+	LengthSum int            `json:"length_sum"`
+	Types     map[string]int `json:"types"`
+}
+
+func (self *FieldStats) add(v interface{}) {
+	self.Count++
+	if filled, _ := FillRate(v); filled > 0 {
+		self.Filled++
+	}
+	if str, ok := v.(string); ok {
+		self.LengthSum += len([]rune(str))
+	}
+	if self.Types == nil {
+		self.Types = map[string]int{}
+	}
+	self.Types[valueType(v)]++
+}
+
+func (self *FieldStats) merge(other *FieldStats) {
+	self.Count += other.Count
+	self.Filled += other.Filled
+	self.LengthSum += other.LengthSum
+	if self.Types == nil {
+		self.Types = map[string]int{}
+	}
+	for k, v := range other.Types {
+		self.Types[k] += v
+	}
+}
+
+func (self *FieldStats) fillRate() float64 {
+	if self.Count == 0 {
+		return 0
+	}
+	return float64(self.Filled) / float64(self.Count)
+}
+
+func (self *FieldStats) avgLength() float64 {
+	if self.Filled == 0 {
+		return 0
+	}
+	return float64(self.LengthSum) / float64(self.Filled)
+}
+
+// mainType is the most frequent type of the filled values.
+func (self *FieldStats) mainType() string {
+	ret, max := "null", 0
+	for k, v := range self.Types {
+		if k == "null" || k == "empty" {
+			continue
+		}
+		if v > max || (v == max && k < ret) {
+			ret, max = k, v
+		}
+	}
+	return ret
+}
+
+type driftBuckets map[string]map[string]*FieldStats
+
+// DriftStore keeps rolling per-config, per-field statistics of extraction
+// results in time buckets and persists them as a json file.
+type DriftStore struct {
+	Path      string
+	Bucket    time.Duration
+	Retention time.Duration
+	lock      sync.Mutex
+	data      map[string]driftBuckets
+}
+
+func NewDriftStore(path string) (*DriftStore, error) {
+	store := &DriftStore{
+		Path:      path,
+		Bucket:    time.Hour,
+		Retention: 30 * 24 * time.Hour,
+		data:      map[string]driftBuckets{},
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return store, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &store.data); err != nil {
+		return nil, fmt.Errorf("drift store %s: %v", path, err)
+	}
+	return store, nil
+}
+
+func (self *DriftStore) bucketKey(t time.Time) string {
+	return strconv.FormatInt(t.Truncate(self.Bucket).Unix(), 10)
+}
+
+func (self *DriftStore) Record(config string, result interface{}) {
+	self.RecordAt(config, result, time.Now())
+}
+
+func (self *DriftStore) RecordAt(config string, result interface{}, t time.Time) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	buckets, ok := self.data[config]
+	if !ok {
+		buckets = driftBuckets{}
+		self.data[config] = buckets
+	}
+	key := self.bucketKey(t)
+	fields, ok := buckets[key]
+	if !ok {
+		fields = map[string]*FieldStats{}
+		buckets[key] = fields
+	}
+	WalkFields("", result, func(path string, v interface{}) {
+		stats, ok := fields[path]
+		if !ok {
+			stats = &FieldStats{}
+			fields[path] = stats
+		}
+		stats.add(v)
+	})
+}
+
+func (self *DriftStore) Save() error {
+	self.lock.Lock()
+	oldest := time.Now().Add(-self.Retention).Unix()
+	for _, buckets := range self.data {
+		for key := range buckets {
+			if ts, _ := strconv.ParseInt(key, 10, 64); ts < oldest {
+				delete(buckets, key)
+			}
+		}
+	}
+	data, err := json.Marshal(self.data)
+	self.lock.Unlock()
+	if err != nil {
+		return err
+	}
+	tmp := self.Path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, self.Path)
+}
+
+func (self *DriftStore) Configs() []string {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	ret := []string{}
+	for config := range self.data {
+		ret = append(ret, config)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+func (self *DriftStore) window(config string, from, to time.Time) map[string]*FieldStats {
+	ret := map[string]*FieldStats{}
+	for key, fields := range self.data[config] {
+		ts, _ := strconv.ParseInt(key, 10, 64)
+		t := time.Unix(ts, 0)
+		if t.Before(from.Truncate(self.Bucket)) || !t.Before(to) {
+			continue
+		}
+		for path, stats := range fields {
+			sum, ok := ret[path]
+			if !ok {
+				sum = &FieldStats{}
+				ret[path] = sum
+			}
+			sum.merge(stats)
+		}
+	}
+	return ret
+}
+
+type FieldDrift struct {
+	Field            string   `json:"field"`
+	BaselineCount    int      `json:"baseline_count"`
+	CurrentCount     int      `json:"current_count"`
+	BaselineFillRate float64  `json:"baseline_fill_rate"`
+	CurrentFillRate  float64  `json:"current_fill_rate"`
+	BaselineLength   float64  `json:"baseline_length"`
+	CurrentLength    float64  `json:"current_length"`
+	BaselineType     string   `json:"baseline_type"`
+	CurrentType      string   `json:"current_type"`
+	Flags            []string `json:"flags,omitempty"`
+}
+
+type DriftReport struct {
+	Config   string       `json:"config"`
+	Baseline string       `json:"baseline"`
+	Current  string       `json:"current"`
+	Drifted  int          `json:"drifted"`
+	Fields   []FieldDrift `json:"fields"`
+}
+
+type DriftOptions struct {
+	Baseline     time.Duration
+	Current      time.Duration
+	FillRateDrop float64
+	LengthChange float64
+}
+
+func DefaultDriftOptions() DriftOptions {
+	return DriftOptions{
+		Baseline:     7 * 24 * time.Hour,
+		Current:      24 * time.Hour,
+		FillRateDrop: 0.2,
+		LengthChange: 0.5,
+	}
+}
+
+// Report compares the current window (the last opts.Current) with the
+// baseline window right before it and flags fields whose fill rate dropped,
+// whose average length changed or whose value type changed.
+func (self *DriftStore) Report(config string, opts DriftOptions, now time.Time) *DriftReport {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	currentFrom := now.Add(-opts.Current)
+	baselineFrom := currentFrom.Add(-opts.Baseline)
+	baseline := self.window(config, baselineFrom, currentFrom.Truncate(self.Bucket))
+	current := self.window(config, currentFrom, now.Add(self.Bucket))
+
+	report := &DriftReport{
+		Config:   config,
+		Baseline: baselineFrom.Format(time.RFC3339) + "/" + currentFrom.Format(time.RFC3339),
+		Current:  currentFrom.Format(time.RFC3339) + "/" + now.Format(time.RFC3339),
+		Fields:   []FieldDrift{},
+	}
+	paths := []string{}
+	for path := range baseline {
+		paths = append(paths, path)
+	}
+	for path := range current {
+		if _, ok := baseline[path]; !ok {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		b, ok := baseline[path]
+		if !ok {
+			b = &FieldStats{}
+		}
+		c, ok := current[path]
+		if !ok {
+			c = &FieldStats{}
+		}
+		drift := FieldDrift{
+			Field:            path,
+			BaselineCount:    b.Count,
+			CurrentCount:     c.Count,
+			BaselineFillRate: b.fillRate(),
+			CurrentFillRate:  c.fillRate(),
+			BaselineLength:   b.avgLength(),
+			CurrentLength:    c.avgLength(),
+			BaselineType:     b.mainType(),
+			CurrentType:      c.mainType(),
+		}
+		if b.Count > 0 && c.Count > 0 {
+			if drift.BaselineFillRate-drift.CurrentFillRate >= opts.FillRateDrop {
+				drift.Flags = append(drift.Flags, "fill_rate_drop")
+			}
+			if drift.BaselineLength > 0 && drift.CurrentLength > 0 &&
+				math.Abs(drift.CurrentLength-drift.BaselineLength)/drift.BaselineLength >= opts.LengthChange {
+				drift.Flags = append(drift.Flags, "length_change")
+			}
+			if b.Filled > 0 && c.Filled > 0 && drift.BaselineType != drift.CurrentType {
+				drift.Flags = append(drift.Flags, "type_change")
+			}
+		} else if b.Count > 0 && b.Filled > 0 {
+			drift.Flags = append(drift.Flags, "field_missing")
+		}
+		if len(drift.Flags) > 0 {
+			report.Drifted++
+		}
+		report.Fields = append(report.Fields, drift)
+	}
+	return report
+}
+
+type DriftArgs struct {
+	Config   string `json:"config"`
+	Baseline string `json:"baseline,omitempty"`
+	Current  string `json:"current,omitempty"`
+}
+
+// Options parses the windows of the args, falling back to the defaults.
+func (self *DriftArgs) Options() (DriftOptions, error) {
+	opts := DefaultDriftOptions()
+	var err error
+	if len(self.Baseline) > 0 {
+		if opts.Baseline, err = time.ParseDuration(self.Baseline); err != nil {
+			return opts, err
+		}
+	}
+	if len(self.Current) > 0 {
+		if opts.Current, err = time.ParseDuration(self.Current); err != nil {
+			return opts, err
+		}
+	}
+	return opts, nil
+}
+
+func (self *Extractor) RpcDrift(args DriftArgs, reply *DriftReport) error {
+	if self.Drift == nil {
+		return fmt.Errorf("drift store not enabled")
+	}
+	opts, err := args.Options()
+	if err != nil {
+		return err
+	}
+	*reply = *self.Drift.Report(args.Config, opts, time.Now())
+	return nil
+}
@@ -0,0 +1,34 @@
+package extractor
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDriftReport(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "drift")
+	defer os.RemoveAll(dir)
+	store, _ := NewDriftStore(filepath.Join(dir, "drift.json"))
+	now := time.Now()
+	for i := 0; i < 10; i++ {
+		store.RecordAt("item", map[string]interface{}{"title": "phone", "price": "199.00"}, now.Add(-48*time.Hour))
+		store.RecordAt("item", map[string]interface{}{"title": nil, "price": "199.00"}, now.Add(-time.Hour))
+	}
+	if err := store.Save(); err != nil {
+		t.Fatal(err)
+	}
+	store, _ = NewDriftStore(filepath.Join(dir, "drift.json"))
+	report := store.Report("item", DefaultDriftOptions(), now)
+	if report.Drifted != 1 {
+		t.Error(report)
+	}
+	for _, field := range report.Fields {
+		if field.Field == "title" && (len(field.Flags) == 0 || field.Flags[0] != "fill_rate_drop") {
+			t.Error(field)
+		}
+	}
+	t.Log(report)
+}
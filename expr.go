@@ -0,0 +1,735 @@
+package extractor
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// The _computed expression language is deliberately small: literals,
+// fields of the current record, parent.field, $var, arithmetic, comparison,
+// && || !, cond ? a : b, a ?? b and a fixed set of functions. Anything
+// missing or invalid evaluates to null rather than failing the record.
+
+// ExprError reports a syntax error in a _computed expression. Col counts
+// characters from 1.
+type ExprError struct {
+	Expr string
+	Col  int
+	Msg  string
+}
+
+func (e *ExprError) Error() string {
+	return fmt.Sprintf("expression %q: column %d: %s", e.Expr, e.Col, e.Msg)
+}
+
+func (e *ExprError) Unwrap() error {
+	return ErrInvalidConfig
+}
+
+const (
+	tokEOF = iota
+	tokNumber
+	tokString
+	tokIdent
+	tokVar
+	tokOp
+)
+
+type exprToken struct {
+	kind int
+	text string
+	pos  int
+}
+
+var exprOps = []string{"??", "==", "!=", "<=", ">=", "&&", "||", "+", "-", "*", "/", "%", "<", ">", "!", "?", ":", "(", ")", "[", "]", ",", "."}
+
+func lexExpr(src string) ([]exprToken, error) {
+	tokens := []exprToken{}
+	errorf := func(pos int, format string, args ...interface{}) error {
+		return &ExprError{Expr: src, Col: utf8.RuneCountInString(src[:pos]) + 1, Msg: fmt.Sprintf(format, args...)}
+	}
+	isIdent := func(r rune, first bool) bool {
+		return r == '_' || unicode.IsLetter(r) || !first && unicode.IsDigit(r)
+	}
+	for i := 0; i < len(src); {
+		r, size := utf8.DecodeRuneInString(src[i:])
+		switch {
+		case unicode.IsSpace(r):
+			i += size
+		case r >= '0' && r <= '9':
+			start := i
+			for i < len(src) && (src[i] >= '0' && src[i] <= '9' || src[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, exprToken{tokNumber, src[start:i], start})
+		case r == '"' || r == '\'':
+			start := i
+			var buf strings.Builder
+			for i++; ; i++ {
+				if i >= len(src) {
+					return nil, errorf(start, "unterminated string")
+				}
+				if src[i] == '\\' && i+1 < len(src) {
+					i++
+					switch src[i] {
+					case 'n':
+						buf.WriteByte('\n')
+					case 't':
+						buf.WriteByte('\t')
+					default:
+						buf.WriteByte(src[i])
+					}
+					continue
+				}
+				if rune(src[i]) == r {
+					i++
+					break
+				}
+				buf.WriteByte(src[i])
+			}
+			tokens = append(tokens, exprToken{tokString, buf.String(), start})
+		case r == '$' || isIdent(r, true):
+			start := i
+			kind := tokIdent
+			if r == '$' {
+				kind = tokVar
+				i++
+			}
+			for i < len(src) {
+				r, size := utf8.DecodeRuneInString(src[i:])
+				if !isIdent(r, false) {
+					break
+				}
+				i += size
+			}
+			name := src[start:i]
+			if kind == tokVar {
+				name = name[1:]
+				if len(name) == 0 {
+					return nil, errorf(start, "$ without a variable name")
+				}
+			}
+			tokens = append(tokens, exprToken{kind, name, start})
+		default:
+			op := ""
+			for _, candidate := range exprOps {
+				if strings.HasPrefix(src[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if len(op) == 0 {
+				return nil, errorf(i, "unexpected %q", r)
+			}
+			tokens = append(tokens, exprToken{tokOp, op, i})
+			i += len(op)
+		}
+	}
+	return append(tokens, exprToken{tokEOF, "", len(src)}), nil
+}
+
+// exprNode is a node of a parsed expression.
+type exprNode struct {
+	op   string // literal, field, var, call, index, unary op or binary op
+	val  interface{}
+	name string
+	args []*exprNode
+}
+
+type exprParser struct {
+	src    string
+	tokens []exprToken
+	pos    int
+}
+
+func (p *exprParser) peek() exprToken {
+	return p.tokens[p.pos]
+}
+
+func (p *exprParser) next() exprToken {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *exprParser) isOp(ops ...string) bool {
+	tok := p.peek()
+	if tok.kind != tokOp {
+		return false
+	}
+	for _, op := range ops {
+		if tok.text == op {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *exprParser) errorf(tok exprToken, format string, args ...interface{}) error {
+	return &ExprError{Expr: p.src, Col: utf8.RuneCountInString(p.src[:tok.pos]) + 1, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *exprParser) expect(op string) error {
+	if !p.isOp(op) {
+		tok := p.peek()
+		if tok.kind == tokEOF {
+			return p.errorf(tok, "expected %s at end of expression", op)
+		}
+		return p.errorf(tok, "expected %s, got %q", op, tok.text)
+	}
+	p.next()
+	return nil
+}
+
+func (p *exprParser) conditional() (*exprNode, error) {
+	cond, err := p.binary(0)
+	if err != nil || !p.isOp("?") {
+		return cond, err
+	}
+	p.next()
+	yes, err := p.conditional()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(":"); err != nil {
+		return nil, err
+	}
+	no, err := p.conditional()
+	if err != nil {
+		return nil, err
+	}
+	return &exprNode{op: "?", args: []*exprNode{cond, yes, no}}, nil
+}
+
+// binaryLevels lists the binary operators from the loosest to the tightest.
+var binaryLevels = [][]string{
+	{"??"},
+	{"||"},
+	{"&&"},
+	{"==", "!="},
+	{"<", "<=", ">", ">="},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+func (p *exprParser) binary(level int) (*exprNode, error) {
+	if level == len(binaryLevels) {
+		return p.unary()
+	}
+	left, err := p.binary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp(binaryLevels[level]...) {
+		op := p.next().text
+		right, err := p.binary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = &exprNode{op: op, args: []*exprNode{left, right}}
+	}
+	return left, nil
+}
+
+func (p *exprParser) unary() (*exprNode, error) {
+	if p.isOp("!", "-") {
+		op := p.next().text
+		arg, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &exprNode{op: "unary" + op, args: []*exprNode{arg}}, nil
+	}
+	return p.postfix()
+}
+
+func (p *exprParser) postfix() (*exprNode, error) {
+	node, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp(".", "[") {
+		if p.next().text == "." {
+			tok := p.next()
+			if tok.kind != tokIdent {
+				return nil, p.errorf(tok, "expected a field name after .")
+			}
+			node = &exprNode{op: "index", args: []*exprNode{node, {op: "literal", val: tok.text}}}
+			continue
+		}
+		index, err := p.conditional()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("]"); err != nil {
+			return nil, err
+		}
+		node = &exprNode{op: "index", args: []*exprNode{node, index}}
+	}
+	return node, nil
+}
+
+func (p *exprParser) primary() (*exprNode, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokNumber:
+		n, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, p.errorf(tok, "bad number %q", tok.text)
+		}
+		return &exprNode{op: "literal", val: n}, nil
+	case tokString:
+		return &exprNode{op: "literal", val: tok.text}, nil
+	case tokVar:
+		return &exprNode{op: "var", name: tok.text}, nil
+	case tokIdent:
+		switch tok.text {
+		case "true", "false":
+			return &exprNode{op: "literal", val: tok.text == "true"}, nil
+		case "null", "nil":
+			return &exprNode{op: "literal"}, nil
+		}
+		if !p.isOp("(") {
+			return &exprNode{op: "field", name: tok.text}, nil
+		}
+		if _, ok := exprFuncs[tok.text]; !ok {
+			return nil, p.errorf(tok, "unknown function %s", tok.text)
+		}
+		p.next()
+		node := &exprNode{op: "call", name: tok.text}
+		for !p.isOp(")") {
+			arg, err := p.conditional()
+			if err != nil {
+				return nil, err
+			}
+			node.args = append(node.args, arg)
+			if !p.isOp(",") {
+				break
+			}
+			p.next()
+		}
+		return node, p.expect(")")
+	case tokOp:
+		if tok.text == "(" {
+			node, err := p.conditional()
+			if err != nil {
+				return nil, err
+			}
+			return node, p.expect(")")
+		}
+	case tokEOF:
+		return nil, p.errorf(tok, "unexpected end of expression")
+	}
+	return nil, p.errorf(tok, "unexpected %q", tok.text)
+}
+
+// parseExpr parses a _computed expression.
+func parseExpr(src string) (*exprNode, error) {
+	tokens, err := lexExpr(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &exprParser{src: src, tokens: tokens}
+	node, err := p.conditional()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, p.errorf(tok, "unexpected %q", tok.text)
+	}
+	return node, nil
+}
+
+// exprEnv resolves the names an expression refers to.
+type exprEnv interface {
+	field(name string) interface{}
+	variable(name string) interface{}
+}
+
+func truthy(v interface{}) bool {
+	switch val := v.(type) {
+	case bool:
+		return val
+	case float64:
+		return val != 0
+	}
+	return !isEmptyValue(v)
+}
+
+func (n *exprNode) eval(env exprEnv) interface{} {
+	switch n.op {
+	case "literal":
+		return n.val
+	case "field":
+		return env.field(n.name)
+	case "var":
+		return env.variable(n.name)
+	case "index":
+		return indexValue(n.args[0].eval(env), n.args[1].eval(env))
+	case "call":
+		args := make([]interface{}, len(n.args))
+		for i, arg := range n.args {
+			args[i] = arg.eval(env)
+		}
+		return exprFuncs[n.name](args)
+	case "?":
+		if truthy(n.args[0].eval(env)) {
+			return n.args[1].eval(env)
+		}
+		return n.args[2].eval(env)
+	case "??":
+		if left := n.args[0].eval(env); !isEmptyValue(left) {
+			return left
+		}
+		return n.args[1].eval(env)
+	case "&&":
+		return truthy(n.args[0].eval(env)) && truthy(n.args[1].eval(env))
+	case "||":
+		return truthy(n.args[0].eval(env)) || truthy(n.args[1].eval(env))
+	case "unary!":
+		return !truthy(n.args[0].eval(env))
+	case "unary-":
+		if x, ok := toNumber(n.args[0].eval(env)); ok {
+			return -x
+		}
+		return nil
+	}
+	return binaryOp(n.op, n.args[0].eval(env), n.args[1].eval(env))
+}
+
+func indexValue(v, key interface{}) interface{} {
+	switch val := v.(type) {
+	case exprEnv:
+		return val.field(valueString(key))
+	case map[string]interface{}:
+		return val[valueString(key)]
+	case map[string]string:
+		if s, ok := val[valueString(key)]; ok {
+			return s
+		}
+		return nil
+	}
+	list := toList(v)
+	i, ok := toInt(key)
+	if list == nil || !ok {
+		return nil
+	}
+	if i < 0 {
+		i += len(list)
+	}
+	if i < 0 || i >= len(list) {
+		return nil
+	}
+	return list[i]
+}
+
+func toList(v interface{}) []interface{} {
+	switch val := v.(type) {
+	case []interface{}:
+		return val
+	case []string:
+		ret := make([]interface{}, len(val))
+		for i, s := range val {
+			ret[i] = s
+		}
+		return ret
+	case []map[string]interface{}:
+		ret := make([]interface{}, len(val))
+		for i, m := range val {
+			ret[i] = m
+		}
+		return ret
+	}
+	return nil
+}
+
+func binaryOp(op string, a, b interface{}) interface{} {
+	switch op {
+	case "==", "!=":
+		equal := isEmptyValue(a) == isEmptyValue(b) && (isEmptyValue(a) || compareValues(a, b) == 0)
+		return equal == (op == "==")
+	case "<", "<=", ">", ">=":
+		if isEmptyValue(a) || isEmptyValue(b) {
+			return false
+		}
+		cmp := compareValues(a, b)
+		switch op {
+		case "<":
+			return cmp < 0
+		case "<=":
+			return cmp <= 0
+		case ">":
+			return cmp > 0
+		}
+		return cmp >= 0
+	}
+	if a == nil || b == nil {
+		return nil
+	}
+	x, xok := toNumber(a)
+	y, yok := toNumber(b)
+	if op == "+" && (!xok || !yok) {
+		return valueString(a) + valueString(b)
+	}
+	if !xok || !yok {
+		return nil
+	}
+	switch op {
+	case "+":
+		return finite(x + y)
+	case "-":
+		return finite(x - y)
+	case "*":
+		return finite(x * y)
+	case "/":
+		if y == 0 {
+			return nil
+		}
+		return finite(x / y)
+	case "%":
+		if y == 0 {
+			return nil
+		}
+		return finite(math.Mod(x, y))
+	}
+	return nil
+}
+
+// finite turns the NaN and infinities that float arithmetic can produce
+// into null, as json has no way to encode them.
+func finite(x float64) interface{} {
+	if math.IsNaN(x) || math.IsInf(x, 0) {
+		return nil
+	}
+	return x
+}
+
+func argString(args []interface{}, i int) string {
+	if i < len(args) {
+		return valueString(args[i])
+	}
+	return ""
+}
+
+func argNumber(args []interface{}, i int) (float64, bool) {
+	if i < len(args) {
+		return toNumber(args[i])
+	}
+	return 0, false
+}
+
+func stringFunc(f func(string) interface{}) func([]interface{}) interface{} {
+	return func(args []interface{}) interface{} {
+		if len(args) == 0 || args[0] == nil {
+			return nil
+		}
+		return f(valueString(args[0]))
+	}
+}
+
+func numberFunc(f func(float64) float64) func([]interface{}) interface{} {
+	return func(args []interface{}) interface{} {
+		if x, ok := argNumber(args, 0); ok {
+			return finite(f(x))
+		}
+		return nil
+	}
+}
+
+func extremum(args []interface{}, less bool) interface{} {
+	var best interface{}
+	for _, arg := range args {
+		values := toList(arg)
+		if values == nil {
+			values = []interface{}{arg}
+		}
+		for _, v := range values {
+			if _, ok := toNumber(v); !ok {
+				continue
+			}
+			if best == nil || (compareValues(v, best) < 0) == less {
+				best = v
+			}
+		}
+	}
+	if x, ok := toNumber(best); ok {
+		return x
+	}
+	return nil
+}
+
+var exprFuncs map[string]func(args []interface{}) interface{}
+
+func init() {
+	exprFuncs = map[string]func(args []interface{}) interface{}{
+		"concat": func(args []interface{}) interface{} {
+			var buf strings.Builder
+			for _, arg := range args {
+				buf.WriteString(valueString(arg))
+			}
+			return buf.String()
+		},
+		"upper": stringFunc(func(s string) interface{} { return strings.ToUpper(s) }),
+		"lower": stringFunc(func(s string) interface{} { return strings.ToLower(s) }),
+		"trim":  stringFunc(func(s string) interface{} { return strings.TrimSpace(s) }),
+		"number": func(args []interface{}) interface{} {
+			if x, ok := argNumber(args, 0); ok {
+				return x
+			}
+			return nil
+		},
+		"string": func(args []interface{}) interface{} {
+			if len(args) == 0 || args[0] == nil {
+				return nil
+			}
+			if x, ok := args[0].(float64); ok {
+				return strconv.FormatFloat(x, 'f', -1, 64)
+			}
+			return valueString(args[0])
+		},
+		"len": func(args []interface{}) interface{} {
+			if len(args) == 0 || args[0] == nil {
+				return float64(0)
+			}
+			if list := toList(args[0]); list != nil {
+				return float64(len(list))
+			}
+			if m, ok := args[0].(map[string]interface{}); ok {
+				return float64(len(m))
+			}
+			return float64(utf8.RuneCountInString(valueString(args[0])))
+		},
+		"substr": func(args []interface{}) interface{} {
+			if len(args) == 0 || args[0] == nil {
+				return nil
+			}
+			runes := []rune(argString(args, 0))
+			start, _ := argNumber(args, 1)
+			from := int(start)
+			if from < 0 {
+				from += len(runes)
+			}
+			if from < 0 {
+				from = 0
+			}
+			if from > len(runes) {
+				from = len(runes)
+			}
+			to := len(runes)
+			if n, ok := argNumber(args, 2); ok && from+int(n) < to {
+				to = from + int(n)
+			}
+			if to < from {
+				to = from
+			}
+			return string(runes[from:to])
+		},
+		"replace": func(args []interface{}) interface{} {
+			if len(args) == 0 || args[0] == nil {
+				return nil
+			}
+			return strings.Replace(argString(args, 0), argString(args, 1), argString(args, 2), -1)
+		},
+		"contains": func(args []interface{}) interface{} {
+			if list := toList(argValue(args, 0)); list != nil {
+				for _, v := range list {
+					if compareValues(v, argValue(args, 1)) == 0 {
+						return true
+					}
+				}
+				return false
+			}
+			return strings.Contains(argString(args, 0), argString(args, 1))
+		},
+		"startswith": func(args []interface{}) interface{} {
+			return strings.HasPrefix(argString(args, 0), argString(args, 1))
+		},
+		"endswith": func(args []interface{}) interface{} {
+			return strings.HasSuffix(argString(args, 0), argString(args, 1))
+		},
+		"split": func(args []interface{}) interface{} {
+			if len(args) == 0 || args[0] == nil {
+				return nil
+			}
+			ret := []interface{}{}
+			for _, s := range strings.Split(argString(args, 0), argString(args, 1)) {
+				ret = append(ret, s)
+			}
+			return ret
+		},
+		"join": func(args []interface{}) interface{} {
+			tks := []string{}
+			for _, v := range toList(argValue(args, 0)) {
+				tks = append(tks, valueString(v))
+			}
+			return strings.Join(tks, argString(args, 1))
+		},
+		"regex": func(args []interface{}) interface{} {
+			reg, err := regexp.Compile(argString(args, 1))
+			if err != nil || len(args) == 0 || args[0] == nil {
+				return nil
+			}
+			m := reg.FindStringSubmatch(argString(args, 0))
+			switch {
+			case m == nil:
+				return nil
+			case len(m) > 1:
+				return m[1]
+			}
+			return m[0]
+		},
+		"round": func(args []interface{}) interface{} {
+			x, ok := argNumber(args, 0)
+			if !ok {
+				return nil
+			}
+			digits, _ := argNumber(args, 1)
+			pow := math.Pow(10, digits)
+			if pow == 0 {
+				return float64(0)
+			}
+			if ret := math.Round(x*pow) / pow; !math.IsNaN(ret) && !math.IsInf(ret, 0) {
+				return ret
+			}
+			// x has fewer digits than asked for and is left as it is
+			return finite(x)
+		},
+		"floor": numberFunc(math.Floor),
+		"ceil":  numberFunc(math.Ceil),
+		"abs":   numberFunc(math.Abs),
+		"min": func(args []interface{}) interface{} {
+			return extremum(args, true)
+		},
+		"max": func(args []interface{}) interface{} {
+			return extremum(args, false)
+		},
+		"coalesce": func(args []interface{}) interface{} {
+			for _, arg := range args {
+				if !isEmptyValue(arg) {
+					return arg
+				}
+			}
+			return nil
+		},
+		"if": func(args []interface{}) interface{} {
+			if truthy(argValue(args, 0)) {
+				return argValue(args, 1)
+			}
+			return argValue(args, 2)
+		},
+	}
+}
+
+func argValue(args []interface{}, i int) interface{} {
+	if i < len(args) {
+		return args[i]
+	}
+	return nil
+}
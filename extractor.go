@@ -4,7 +4,10 @@ import (
 	"bytes"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"net/url"
 	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/PuerkitoBio/goquery"
@@ -14,17 +17,49 @@ import (
 )
 
 const (
-	SET_DEFINE      = "_v"
-	TYPE_DEFINE     = "_type"
-	JSONTYPE_DEFINE = "_jsontype"
-	ROOT_DEFINE     = "_root"
-	ERROR_DEFINE    = "_error"
-	SOURCE_DEFINE   = "_source"
+	SET_DEFINE         = "_v"
+	TYPE_DEFINE        = "_type"
+	JSONTYPE_DEFINE    = "_jsontype"
+	ROOT_DEFINE        = "_root"
+	ERROR_DEFINE       = "_error"
+	SOURCE_DEFINE      = "_source"
+	MATCH_DEFINE       = "_match"
+	SELECT_DEFINE      = "_select"
+	NAME_DEFINE        = "_name"
+	DEFS_DEFINE        = "_defs"
+	REF_DEFINE         = "$ref"
+	TABLE_DEFINE       = "_table"
+	HEADER_ROWS_DEFINE = "_headerrows"
+	PAIRS_DEFINE       = "_pairs"
+	WHERE_DEFINE       = "_where"
+	UNIQUE_DEFINE      = "_unique"
+	SORT_DEFINE        = "_sort"
+	LIMIT_DEFINE       = "_limit"
+	OFFSET_DEFINE      = "_offset"
+	SKIPEMPTY_DEFINE   = "_skipempty"
+	COMPUTED_DEFINE    = "_computed"
+)
+
+var (
+	ErrInvalidConfig = errors.New("invalid config")
+	ErrParseBody     = errors.New("parse body error")
+	ErrExtract       = errors.New("extract error")
 )
 
 type Extractor struct {
 	Filter     func(config string) (string, bool)
 	DoTemplate func(template, v string) string
+	Library    *ConfigLibrary
+	Drift      *DriftStore
+	trace      *Trace
+	scope      *recordScope
+	exprs      map[string]*exprNode
+	BaseURL    string
+	Vars       map[string]string
+	// LegacySelectors accepts selectors that do not follow the selector
+	// grammar and splits them on ";" and ">|" the way they were split
+	// before it, instead of failing with ErrInvalidConfig.
+	LegacySelectors bool
 }
 
 func NewExtractor() *Extractor {
@@ -44,7 +79,58 @@ func (self *Extractor) root(config map[string]interface{}) string {
 	if ok || len(v) > 0 {
 		xpath = v
 	}
-	return xpath.(string)
+	return self.vars(xpath.(string))
+}
+
+var varRegex = regexp.MustCompile(`\[\$([^\]]+)\]`)
+
+// vars replaces the [$name] placeholders of a selector with the caller
+// supplied Vars.
+func (self *Extractor) vars(v string) string {
+	if len(self.Vars) == 0 || !strings.Contains(v, "[$") {
+		return v
+	}
+	return varRegex.ReplaceAllStringFunc(v, func(placeholder string) string {
+		name := placeholder[2 : len(placeholder)-1]
+		if val, ok := self.Vars[name]; ok {
+			return val
+		}
+		return placeholder
+	})
+}
+
+// urlAttrs are the attributes whose values are resolved by absURL.
+var urlAttrs = map[string]bool{
+	"href":          true,
+	"src":           true,
+	"data-src":      true,
+	"data-original": true,
+	"data-lazy":     true,
+	"poster":        true,
+	"action":        true,
+}
+
+// absURL resolves link against BaseURL. Without one, protocol relative
+// links get https and anything else is left alone, as are data: and
+// javascript: links.
+func (self *Extractor) absURL(link string) string {
+	link = strings.TrimSpace(link)
+	if len(link) == 0 || strings.HasPrefix(link, "data:") || strings.HasPrefix(link, "javascript:") {
+		return link
+	}
+	if len(self.BaseURL) > 0 {
+		base, err := url.Parse(self.BaseURL)
+		if err == nil {
+			ref, err := url.Parse(link)
+			if err == nil {
+				return base.ResolveReference(ref).String()
+			}
+		}
+	}
+	if strings.HasPrefix(link, "//") {
+		return "https:" + link
+	}
+	return link
 }
 
 func (self *Extractor) dataType(config map[string]interface{}) string {
@@ -98,7 +184,39 @@ func (self *Extractor) RpcParse(params string, reply *string) error {
 	}
 	var body []byte
 	body = []byte(split[1])
-	ret := self.Do(m, body)
+	return self.reply(self.Do(m, body), reply)
+}
+
+type NamedParams struct {
+	Config string `json:"config"`
+	Body   string `json:"body"`
+}
+
+func (self *Extractor) RpcParseNamed(params string, reply *string) error {
+	var p NamedParams
+	err := json.Unmarshal([]byte(params), &p)
+	if err != nil {
+		dlog.Warn("%v with %s", err, params)
+		return err
+	}
+	config, err := self.namedConfig(p.Config)
+	if err != nil {
+		dlog.Warn("%v", err)
+		return err
+	}
+	return self.reply(self.Do(config, []byte(p.Body)), reply)
+}
+
+func (self *Extractor) RpcStatus(args string, reply *[]ConfigStatus) error {
+	if self.Library == nil {
+		*reply = []ConfigStatus{}
+		return nil
+	}
+	*reply = self.Library.Status()
+	return nil
+}
+
+func (self *Extractor) reply(ret interface{}, reply *string) error {
 	if ret == nil {
 		dlog.Warn("return nil")
 		return errors.New("return nil")
@@ -107,7 +225,7 @@ func (self *Extractor) RpcParse(params string, reply *string) error {
 		*reply = str
 		return nil
 	}
-	body, err = json.Marshal(ret)
+	body, err := json.Marshal(ret)
 	if err != nil {
 		dlog.Warn("%v", err)
 		return err
@@ -120,8 +238,39 @@ func (self *Extractor) RpcParse(params string, reply *string) error {
 }
 
 func (self *Extractor) Do(config interface{}, body []byte) interface{} {
+	ret, err := self.Parse(config, body)
+	if err != nil {
+		dlog.Warn("%s", err.Error())
+		return nil
+	}
+	return ret
+}
+
+func (self *Extractor) Parse(config interface{}, body []byte) (interface{}, error) {
+	// records under extraction and the parsed expressions of the config
+	// are kept on a per-call copy
+	ex := *self
+	ex.scope = nil
+	return ex.parse(config, body)
+}
+
+func (self *Extractor) parse(config interface{}, body []byte) (interface{}, error) {
+	config, err := self.ResolveRefs(config)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+	}
+	if err := self.checkSelectors(config); err != nil {
+		return nil, err
+	}
+	self.exprs = map[string]*exprNode{}
+	if err := compileComputed(config, self.exprs); err != nil {
+		return nil, err
+	}
 	var ret interface{}
 	if m, ok := config.(map[string]interface{}); ok {
+		if _, ok := m[SELECT_DEFINE]; ok {
+			return self.doSelect(m, body)
+		}
 		val, ok := self.source(m)
 		if ok {
 			body = val
@@ -131,27 +280,42 @@ func (self *Extractor) Do(config interface{}, body []byte) interface{} {
 			jsonBody := FilterJSONP(string(body))
 			json, err := simplejson.NewFromReader(strings.NewReader(jsonBody))
 			if err != nil {
-				dlog.Warn("%s", err.Error())
-				return nil
+				return nil, fmt.Errorf("%w: %v", ErrParseBody, err)
 			}
 			ret = self.extractJson(m, json)
 		} else if dataType == "html" {
 			doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
 			if err != nil {
-				dlog.Warn("%s", err.Error())
-				return nil
+				return nil, fmt.Errorf("%w: %v", ErrParseBody, err)
 			}
 			ret = self.extract(config, doc.First())
+		} else if dataType == "metadata" {
+			doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+			if err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrParseBody, err)
+			}
+			ret = self.extractJson(m, NewSimplejson(Metadata(doc.First())))
+		} else if dataType == "article" {
+			doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+			if err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrParseBody, err)
+			}
+			ret = self.extractJson(m, NewSimplejson(self.Article(doc.First())))
 		} else if dataType == "xml" {
 		} else if dataType == "string" {
 			input := html.UnescapeString(string(body))
 			ret = self.extractString(config, input)
+		} else {
+			return nil, fmt.Errorf("%w: unknown type %s", ErrInvalidConfig, dataType)
 		}
 	} else if a, ok := config.([]interface{}); ok {
 		dataType := "html"
 		val := string(body)
 		for _, single := range a {
-			c := single.(string)
+			c, ok := single.(string)
+			if !ok {
+				return nil, fmt.Errorf("%w: %v is not a string", ErrInvalidConfig, single)
+			}
 			switch c {
 			case "_html", "html":
 				dataType = "html"
@@ -167,33 +331,33 @@ func (self *Extractor) Do(config interface{}, body []byte) interface{} {
 			if dataType == "html" {
 				doc, err := goquery.NewDocumentFromReader(strings.NewReader(val))
 				if err != nil {
-					dlog.Warn("%s", err.Error())
-					return nil
+					return nil, fmt.Errorf("%w: %v", ErrParseBody, err)
 				}
-				val = self.extractSingle(c, doc.First()).(string)
+				val, _ = self.extractSingle(c, doc.First()).(string)
 				if val == "" {
-					return nil
+					return nil, nil
 				}
 			} else if dataType == "json" {
 				jsonBody := FilterJSONP(val)
 				json, err := simplejson.NewFromReader(strings.NewReader(jsonBody))
 				if err != nil {
-					dlog.Warn("%s: %s", jsonBody, err.Error())
-					return nil
+					return nil, fmt.Errorf("%w: %v", ErrParseBody, err)
 				}
-				return self.ExtractJsonSingle(c, json)
+				return self.ExtractJsonSingle(c, json), nil
 			} else if dataType == "string" {
 				val2 := self.extractString(c, val)
 				if val2 == nil {
 					dlog.Warn("return nil")
-					return nil
+					return nil, nil
 				}
 				val = val2.(string)
 			}
 		}
-		return val
+		return val, nil
+	} else {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidConfig, config)
 	}
-	return ret
+	return ret, nil
 }
 
 func (self *Extractor) extract(config interface{}, s *goquery.Selection) interface{} {
@@ -204,10 +368,12 @@ func (self *Extractor) extract(config interface{}, s *goquery.Selection) interfa
 		} else if len(filterValue) > 0 {
 			v = filterValue
 		}
+		v = self.vars(v)
 		val := self.extractSingle(v, s)
 		if val == "" {
 			val = nil
 		}
+		self.traceValue(val)
 		return val
 	}
 
@@ -219,6 +385,7 @@ func (self *Extractor) extract(config interface{}, s *goquery.Selection) interfa
 		if len(ed) > 0 {
 			edoc := queryXpath(ed, s)
 			if edoc == nil || edoc.Size() == 0 {
+				self.traceError("_error " + ed + " matched nothing")
 				return map[string]string{
 					"error": "页面错误",
 				}
@@ -226,23 +393,52 @@ func (self *Extractor) extract(config interface{}, s *goquery.Selection) interfa
 		}
 
 		rt := self.root(m)
+		if rt == AUTO_ROOT {
+			m = self.autoConfig(s, m)
+			if m == nil {
+				self.traceError("no repeated structure found")
+				return []map[string]interface{}{}
+			}
+			rt = self.root(m)
+		}
 		if len(rt) > 0 {
 			isArray = strings.Contains(rt, "@array")
 			rt = strings.Replace(rt, "@array", "", 1)
 			doc = queryXpath(rt, s)
+			if doc != nil {
+				self.traceRoot(rt, doc.Size())
+			} else {
+				self.traceRoot(rt, 0)
+			}
 		}
 		if doc == nil || doc.Size() == 0 {
 			if isArray {
 				return []map[string]interface{}{}
 			}
 			return nil
-		} else if isArray || doc.Size() > 1 {
+		} else if m[TABLE_DEFINE] == true {
+			return shape(m, self.extractTable(m, doc))
+		} else if m[PAIRS_DEFINE] == true {
+			if !hasShape(m) {
+				return self.extractPairRecord(m, doc.First())
+			}
+			// shaping keys make one record per match, as for other roots
+			ret := []map[string]interface{}{}
+			doc.Each(func(i int, stmp *goquery.Selection) {
+				leave := self.traceEnter("[" + strconv.Itoa(i) + "]")
+				ret = append(ret, self.extractPairRecord(m, stmp))
+				leave()
+			})
+			return shape(m, ret)
+		} else if isArray || doc.Size() > 1 || hasShape(m) {
 			ret := []map[string]interface{}{}
 			doc.Each(func(i int, stmp *goquery.Selection) {
+				leave := self.traceEnter("[" + strconv.Itoa(i) + "]")
 				sub := self.extractContainKey(m, stmp)
+				leave()
 				ret = append(ret, sub)
 			})
-			return ret
+			return shape(m, ret)
 		} else if doc.Size() == 1 {
 			return self.extractContainKey(m, doc)
 		}
@@ -250,15 +446,29 @@ func (self *Extractor) extract(config interface{}, s *goquery.Selection) interfa
 	return nil
 }
 
+// extractPairRecord reads the label/value pairs under s together with the
+// fields of m.
+func (self *Extractor) extractPairRecord(m map[string]interface{}, s *goquery.Selection) map[string]interface{} {
+	ret := self.extractPairs(s)
+	for key, val := range self.extractContainKey(m, s) {
+		ret[key] = val
+	}
+	return ret
+}
+
 func (self *Extractor) extractContainKey(m map[string]interface{}, s *goquery.Selection) map[string]interface{} {
 	ret := make(map[string]interface{})
-	for key, val := range m {
+	defer self.enterRecord(m, ret)()
+	for _, key := range nestedLast(m) {
+		val := m[key]
 		if strings.HasPrefix(key, "_") {
 			continue
 		}
 		if strings.HasPrefix(key, "@key") {
 			keyXpath := strings.Replace(key, "@key", "", -1)
+			leave := self.traceEnter(key)
 			keyResult := self.extract(keyXpath, s)
+			leave()
 			if keyResult != nil {
 				key = keyResult.(string)
 			} else {
@@ -270,13 +480,18 @@ func (self *Extractor) extractContainKey(m map[string]interface{}, s *goquery.Se
 			tks := strings.SplitN(key, " ", 2)
 			key = tks[len(tks)-1]
 			if tmp, ok := ret[key]; !ok || tmp == nil {
+				leave := self.traceEnter(key)
 				ret[key] = self.extract(val, s)
+				leave()
 			} else {
 				continue
 			}
 		}
+		leave := self.traceEnter(key)
 		ret[key] = self.extract(val, s)
+		leave()
 	}
+	self.computeFields()
 	return ret
 }
 
@@ -285,22 +500,39 @@ type HtmlSelector struct {
 	Attr     string
 	Regex    string
 	Template string
+	All      bool
+	Unique   bool
+	NoEmpty  bool
 }
 
+var allModifier = regexp.MustCompile(`@all(?:\(([^)]*)\))?`)
+
 func NewHtmlSelector(v string) *HtmlSelector {
-	ret := &HtmlSelector{}
-	if strings.Contains(v, ">|") {
-		tks := strings.Split(v, ">|")
-		v = tks[0]
-		ret.Template = tks[1]
-	}
-	tks := strings.Split(v, ";")
-	ret.Xpath = tks[0]
-	if len(tks) > 1 {
-		ret.Attr = tks[1]
-	}
-	if len(tks) > 2 {
-		ret.Regex = tks[2]
+	return newHtmlSelector(parseSelector(v, false))
+}
+
+func (self *Extractor) htmlSelector(v string) *HtmlSelector {
+	return newHtmlSelector(parseSelector(v, self.LegacySelectors))
+}
+
+func newHtmlSelector(ast *SelectorAST) *HtmlSelector {
+	ret := &HtmlSelector{
+		Xpath:    ast.Path.text(),
+		Attr:     ast.Attr.text(),
+		Regex:    ast.Regex.text(),
+		Template: ast.Template.text(),
+	}
+	if m := allModifier.FindStringSubmatch(ret.Xpath); m != nil {
+		ret.All = true
+		for _, opt := range strings.Split(m[1], ",") {
+			switch strings.TrimSpace(opt) {
+			case "unique":
+				ret.Unique = true
+			case "noempty":
+				ret.NoEmpty = true
+			}
+		}
+		ret.Xpath = strings.TrimSpace(strings.Replace(ret.Xpath, m[0], "", 1))
 	}
 	return ret
 }
@@ -360,39 +592,126 @@ func (self *Extractor) extractSingle(v string, s *goquery.Selection) interface{}
 		}
 		return data
 	}
-	sel := NewHtmlSelector(v)
+	if strings.Contains(v, "@label(") {
+		return self.extractLabel(v, s)
+	}
+	if strings.HasPrefix(v, "@jsonld") {
+		return self.extractJsonLD(v, s)
+	}
+	if strings.HasPrefix(v, ARTICLE_SELECTOR) {
+		return self.extractArticle(v, s)
+	}
+	sel := self.htmlSelector(v)
 	b := s
 	if len(sel.Xpath) > 0 {
 		b = queryXpath(sel.Xpath, s)
 	}
+	if b == nil || b.Size() == 0 {
+		self.traceSelector(v, 0)
+		self.traceHtmlSteps(sel.Xpath, s)
+	} else {
+		self.traceSelector(v, b.Size())
+		self.traceHtml(b)
+	}
 	if b == nil {
 		return nil
 	}
-	var text string
-	if len(sel.Attr) > 0 {
-		if sel.Attr == "html" {
-			text, _ = b.First().Html()
-		} else {
-			text, _ = b.First().Attr(sel.Attr)
-			if (sel.Attr == "href" || sel.Attr == "src") && strings.HasPrefix(text, "//") {
-				text = "https:" + text
-			}
-			text = strings.TrimSpace(text)
-		}
-	} else {
-		text = strings.TrimSpace(b.First().Text())
+	if sel.All {
+		return self.extractAll(sel, b)
+	}
+	if structuredModes[sel.Attr] {
+		val := structuredValue(sel.Attr, b.First())
+		self.traceRaw(val)
+		return val
 	}
+	text := self.nodeText(sel, b.First())
 
+	self.traceRaw(text)
 	text, ret := Regex(sel.Regex, text)
 	if ret != nil {
+		self.traceRegex(sel.Regex, ret)
 		return ret
 	}
+	self.traceRegex(sel.Regex, text)
 	if len(sel.Template) > 0 {
 		text = self.DoTemplate(sel.Template, text)
 	}
 	return text
 }
 
+// extractAll applies the attribute, regex and template of sel to every node in b
+func (self *Extractor) extractAll(sel *HtmlSelector, b *goquery.Selection) interface{} {
+	if structuredModes[sel.Attr] {
+		values := []interface{}{}
+		b.Each(func(i int, node *goquery.Selection) {
+			values = append(values, structuredValue(sel.Attr, node))
+		})
+		return values
+	}
+	ret := []string{}
+	seen := map[string]bool{}
+	add := func(text string) {
+		if sel.NoEmpty && len(text) == 0 {
+			return
+		}
+		if sel.Unique {
+			if seen[text] {
+				return
+			}
+			seen[text] = true
+		}
+		ret = append(ret, text)
+	}
+	b.Each(func(i int, node *goquery.Selection) {
+		text, multi := Regex(sel.Regex, self.nodeText(sel, node))
+		if multi != nil {
+			for _, m := range multi {
+				add(m)
+			}
+			return
+		}
+		if len(sel.Template) > 0 {
+			text = self.DoTemplate(sel.Template, text)
+		}
+		add(text)
+	})
+	self.traceRegex(sel.Regex, ret)
+	return ret
+}
+
+// nodeText returns the raw value of a single node according to the attribute of sel
+func (self *Extractor) nodeText(sel *HtmlSelector, node *goquery.Selection) string {
+	var text string
+	switch sel.Attr {
+	case "":
+		text = strings.TrimSpace(node.Text())
+	case "html":
+		text, _ = node.Html()
+	case "markdown":
+		text = self.Markdown(node)
+	case "innertext":
+		text = InnerText(node)
+	case "owntext":
+		if node.Size() > 0 {
+			text = ownText(node)
+		}
+	case "outerhtml":
+		text, _ = goquery.OuterHtml(node)
+	case "comment":
+		text = commentText(node)
+	default:
+		if isImgAttr(sel.Attr) {
+			return self.imageURL(imgPriorityOf(sel.Attr), node)
+		}
+		text, _ = node.Attr(sel.Attr)
+		text = strings.TrimSpace(text)
+		if urlAttrs[sel.Attr] {
+			text = self.absURL(text)
+		}
+	}
+	return text
+}
+
 func queryXpath(xpath string, s *goquery.Selection) *goquery.Selection {
 	defer func() {
 		if err := recover(); err != nil {
@@ -400,28 +719,10 @@ func queryXpath(xpath string, s *goquery.Selection) *goquery.Selection {
 		}
 	}()
 
-	var b *goquery.Selection
-	index, ok := FindIntAttribute("index", xpath)
-	parent, ok2 := FindIntAttribute("parent", xpath)
-	if ok {
-		xpath = CleanAttribute("index", xpath)
-		b = s.Find(xpath)
-		b = b.Eq(index)
-	} else if ok2 {
-		xpath = CleanAttribute("parent", xpath)
-		b = s.Find(xpath)
-		if b.Size() > 1 {
-			b = b.First()
-		}
-		for x := 0; x < parent; x++ {
-			b = b.Parent()
-		}
-	} else if strings.Contains(xpath, "@last") {
-		xpath = strings.Replace(xpath, "@last", "", 1)
-		b = s.Find(xpath)
-		b = b.Last()
-	} else {
-		b = s.Find(xpath)
+	b, err := navigate(xpath, s)
+	if err != nil {
+		dlog.Warn("queryXpath Error:%s", err.Error())
+		return nil
 	}
 	return b
 }
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"zhongguo/extractor"
+)
+
+type batchRecord struct {
+	File   string      `json:"file"`
+	Result interface{} `json:"result"`
+	Errors []string    `json:"errors,omitempty"`
+}
+
+type fieldStats struct {
+	Total    int            `json:"total"`
+	Filled   int            `json:"filled"`
+	FillRate float64        `json:"fill_rate"`
+	Distinct int            `json:"distinct"`
+	Samples  []string       `json:"samples,omitempty"`
+	values   map[string]int `json:"-"`
+}
+
+const batchSamples = 5
+
+// batchSummary collects per-field statistics over the results of a batch.
+type batchSummary struct {
+	Files  int                    `json:"files"`
+	Failed int                    `json:"failed"`
+	Fields map[string]*fieldStats `json:"fields"`
+}
+
+func newBatchSummary() *batchSummary {
+	return &batchSummary{Fields: map[string]*fieldStats{}}
+}
+
+func (self *batchSummary) add(record *batchRecord) {
+	self.Files++
+	if len(record.Errors) > 0 {
+		self.Failed++
+	}
+	extractor.WalkFields("", record.Result, self.addValue)
+}
+
+func (self *batchSummary) addValue(path string, v interface{}) {
+	stats, ok := self.Fields[path]
+	if !ok {
+		stats = &fieldStats{values: map[string]int{}}
+		self.Fields[path] = stats
+	}
+	stats.Total++
+	filled, _ := extractor.FillRate(v)
+	if filled == 0 {
+		return
+	}
+	stats.Filled++
+	key := fmt.Sprint(v)
+	if _, ok := stats.values[key]; !ok && len(stats.Samples) < batchSamples {
+		if runes := []rune(key); len(runes) > 80 {
+			key = string(runes[:80]) + "..."
+		}
+		stats.Samples = append(stats.Samples, key)
+	}
+	stats.values[fmt.Sprint(v)]++
+}
+
+func (self *batchSummary) finish() {
+	for _, stats := range self.Fields {
+		stats.Distinct = len(stats.values)
+		if stats.Total > 0 {
+			stats.FillRate = float64(stats.Filled) / float64(stats.Total)
+		}
+	}
+}
+
+func (self *batchSummary) print(w *os.File) {
+	paths := []string{}
+	for path := range self.Fields {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	fmt.Fprintf(w, "files: %d failed: %d\n", self.Files, self.Failed)
+	for _, path := range paths {
+		stats := self.Fields[path]
+		fmt.Fprintf(w, "%-40s %6.1f%% %6d distinct  %s\n", path, stats.FillRate*100, stats.Distinct, strings.Join(stats.Samples, " | "))
+	}
+}
+
+// normalize gives a result the shape it has after a json round trip, so that
+// fresh and resumed records are summarized alike.
+func normalize(v interface{}) interface{} {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	var ret interface{}
+	if err := json.Unmarshal(data, &ret); err != nil {
+		return v
+	}
+	return ret
+}
+
+func listFiles(root string, include, exclude string, maxFiles int) ([]string, error) {
+	files := []string{}
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		name := filepath.Base(path)
+		if len(include) > 0 {
+			if ok, _ := filepath.Match(include, name); !ok {
+				return nil
+			}
+		}
+		if len(exclude) > 0 {
+			if ok, _ := filepath.Match(exclude, name); ok {
+				return nil
+			}
+		}
+		files = append(files, path)
+		return nil
+	})
+	sort.Strings(files)
+	if maxFiles > 0 && len(files) > maxFiles {
+		files = files[:maxFiles]
+	}
+	return files, err
+}
+
+// readDone loads the records of an earlier run so that it can be resumed. A
+// last line without its newline was cut short by a crash, so it is dropped
+// from the file and its document extracted again.
+func readDone(path string, summary *batchSummary) (map[string]bool, error) {
+	done := map[string]bool{}
+	f, err := os.OpenFile(path, os.O_RDWR, 0644)
+	if os.IsNotExist(err) {
+		return done, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	reader := bufio.NewReader(f)
+	offset := int64(0)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			if len(line) > 0 {
+				return done, f.Truncate(offset)
+			}
+			return done, nil
+		} else if err != nil {
+			return nil, err
+		}
+		offset += int64(len(line))
+		record := &batchRecord{}
+		if err := json.Unmarshal(line, record); err != nil {
+			continue
+		}
+		done[record.File] = true
+		summary.add(record)
+	}
+}
+
+func batch(args []string) int {
+	fs := flag.NewFlagSet("batch", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: extractor batch -c config.json [flags] ./pages/")
+		fs.PrintDefaults()
+	}
+	tmpl := &requestTemplate{}
+	tmpl.bind(fs)
+	workers := fs.Int("workers", runtime.NumCPU(), "number of parallel workers")
+	include := fs.String("include", "", "only process files matching this glob, e.g. *.html")
+	exclude := fs.String("exclude", "", "skip files matching this glob")
+	maxFiles := fs.Int("max-files", 0, "process at most this many files, 0 for all")
+	outPath := fs.String("o", "", "jsonl output file, default stdout")
+	resume := fs.Bool("resume", false, "skip files already present in -o")
+	driftPath := fs.String("drift", "", "record field statistics into this drift store")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return exitUsage
+	}
+	if *workers < 1 {
+		fmt.Fprintf(os.Stderr, "-workers must be at least 1, got %d\n", *workers)
+		return exitUsage
+	}
+
+	ex, req, err := tmpl.extractor()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "config: %s\n", err)
+		return exitConfig
+	}
+	files, err := listFiles(fs.Arg(0), *include, *exclude, *maxFiles)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return exitError
+	}
+
+	var drift *extractor.DriftStore
+	if len(*driftPath) > 0 {
+		if drift, err = extractor.NewDriftStore(*driftPath); err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			return exitError
+		}
+	}
+
+	summary := newBatchSummary()
+	out := os.Stdout
+	if len(*outPath) > 0 {
+		done := map[string]bool{}
+		flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+		if *resume {
+			if done, err = readDone(*outPath, summary); err != nil {
+				fmt.Fprintf(os.Stderr, "%s\n", err)
+				return exitError
+			}
+			flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+		}
+		if out, err = os.OpenFile(*outPath, flags, 0644); err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			return exitError
+		}
+		defer out.Close()
+		todo := []string{}
+		for _, file := range files {
+			if !done[file] {
+				todo = append(todo, file)
+			}
+		}
+		files = todo
+	}
+
+	jobs := make(chan string)
+	records := make(chan *batchRecord)
+	wg := sync.WaitGroup{}
+	for i := 0; i < *workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for file := range jobs {
+				record := &batchRecord{File: file}
+				body, err := readBody(file, tmpl.charset)
+				if err != nil {
+					record.Errors = []string{err.Error()}
+					records <- record
+					continue
+				}
+				fileReq := *req
+				fileReq.Body = body
+				resp, _ := ex.DoRequest(&fileReq)
+				record.Result = normalize(resp.Result)
+				record.Errors = resp.Errors
+				records <- record
+			}
+		}()
+	}
+	go func() {
+		for _, file := range files {
+			jobs <- file
+		}
+		close(jobs)
+		wg.Wait()
+		close(records)
+	}()
+
+	w := bufio.NewWriter(out)
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	for record := range records {
+		summary.add(record)
+		if drift != nil && len(record.Errors) == 0 {
+			drift.Record(tmpl.name(), record.Result)
+		}
+		enc.Encode(record)
+		// a record is on disk as soon as it is done, so -resume loses at
+		// most the one being written
+		w.Flush()
+	}
+	if drift != nil {
+		if err := drift.Save(); err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+		}
+	}
+
+	summary.finish()
+	summary.print(os.Stderr)
+	if summary.Failed > 0 {
+		return exitExtract
+	}
+	return exitOK
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// readRecords reads a batch output file as a sorted list of file names and
+// the records by file name.
+func readRecords(t *testing.T, path string) ([]string, map[string]*batchRecord) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := []string{}
+	records := map[string]*batchRecord{}
+	for _, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+		if len(line) == 0 {
+			continue
+		}
+		record := &batchRecord{}
+		if err := json.Unmarshal([]byte(line), record); err != nil {
+			t.Fatalf("bad line %q: %s", line, err)
+		}
+		files = append(files, filepath.Base(record.File))
+		records[filepath.Base(record.File)] = record
+	}
+	sort.Strings(files)
+	return files, records
+}
+
+func TestBatch(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"item.json":      `{"title":"h1"}`,
+		"list.json":      `{"_root":"ul","name":"li"}`,
+		"pages/a.html":   `<h1>A</h1>`,
+		"pages/b.html":   `<h1>B</h1>`,
+		"pages/c.html":   `<p>none</p>`,
+		"pages/skip.txt": `<h1>S</h1>`,
+	})
+	path := func(name string) string {
+		return filepath.Join(dir, name)
+	}
+	pages := path("pages")
+	cases := []struct {
+		name  string
+		args  []string
+		code  int
+		files string
+	}{
+		{"all", []string{"-c", path("item.json"), "-o", path("all.jsonl"), pages}, exitOK, "a.html b.html c.html skip.txt"},
+		{"include", []string{"-c", path("item.json"), "-include", "*.html", "-o", path("include.jsonl"), pages}, exitOK, "a.html b.html c.html"},
+		{"exclude", []string{"-c", path("item.json"), "-exclude", "*.txt", "-workers", "1", "-o", path("exclude.jsonl"), pages}, exitOK, "a.html b.html c.html"},
+		{"max files", []string{"-c", path("item.json"), "-max-files", "2", "-o", path("max.jsonl"), pages}, exitOK, "a.html b.html"},
+		{"errors", []string{"-c", path("list.json"), "-include", "*.html", "-o", path("errors.jsonl"), pages}, exitExtract, "a.html b.html c.html"},
+		{"zero workers", []string{"-c", path("item.json"), "-workers", "0", "-o", path("zero.jsonl"), pages}, exitUsage, ""},
+		{"negative workers", []string{"-c", path("item.json"), "-workers", "-2", "-o", path("negative.jsonl"), pages}, exitUsage, ""},
+		{"no dir", []string{"-c", path("item.json")}, exitUsage, ""},
+		{"no config", []string{pages}, exitConfig, ""},
+	}
+	for _, c := range cases {
+		code := batch(c.args)
+		if code != c.code {
+			t.Errorf("%s: exit %d, want %d", c.name, code, c.code)
+			continue
+		}
+		if code != exitOK && code != exitExtract {
+			continue
+		}
+		files, _ := readRecords(t, c.args[len(c.args)-2])
+		if strings.Join(files, " ") != c.files {
+			t.Errorf("%s: %v", c.name, files)
+		}
+	}
+}
+
+func TestBatchResume(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"item.json":    `{"title":"h1"}`,
+		"pages/a.html": `<h1>A</h1>`,
+		"pages/b.html": `<h1>B</h1>`,
+		"pages/c.html": `<h1>C</h1>`,
+	})
+	pages := filepath.Join(dir, "pages")
+	out := filepath.Join(dir, "out.jsonl")
+	// a.html was done, b.html was being written when the run crashed
+	previous := `{"file":"` + filepath.Join(pages, "a.html") + `","result":{"title":"kept"}}` + "\n" +
+		`{"file":"` + filepath.Join(pages, "b.html") + `","result":{"ti`
+	ioutil.WriteFile(out, []byte(previous), 0644)
+
+	if code := batch([]string{"-c", filepath.Join(dir, "item.json"), "-resume", "-o", out, pages}); code != exitOK {
+		t.Fatalf("exit %d", code)
+	}
+	files, records := readRecords(t, out)
+	if strings.Join(files, " ") != "a.html b.html c.html" {
+		t.Fatalf("%v", files)
+	}
+	for file, title := range map[string]string{"a.html": "kept", "b.html": "B", "c.html": "C"} {
+		result, _ := records[file].Result.(map[string]interface{})
+		if result["title"] != title {
+			t.Errorf("%s: %v", file, records[file].Result)
+		}
+	}
+}
+
+func TestBatchSummarySamples(t *testing.T) {
+	summary := newBatchSummary()
+	long := strings.Repeat("中文", 50)
+	summary.add(&batchRecord{File: "a.html", Result: map[string]interface{}{"title": long}})
+	summary.finish()
+	sample := summary.Fields["title"].Samples[0]
+	if sample != strings.Repeat("中文", 40)+"..." {
+		t.Errorf("%q", sample)
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+	"zhongguo/extractor"
+)
+
+func printDrift(report *extractor.DriftReport) {
+	fmt.Printf("%s: %d drifted fields\n", report.Config, report.Drifted)
+	fmt.Printf("  baseline %s\n  current  %s\n", report.Baseline, report.Current)
+	for _, field := range report.Fields {
+		mark := " "
+		if len(field.Flags) > 0 {
+			mark = "!"
+		}
+		fmt.Printf("%s %-40s fill %5.1f%% -> %5.1f%%  len %6.1f -> %6.1f  type %s -> %s  %s\n",
+			mark, field.Field,
+			field.BaselineFillRate*100, field.CurrentFillRate*100,
+			field.BaselineLength, field.CurrentLength,
+			field.BaselineType, field.CurrentType,
+			strings.Join(field.Flags, ","))
+	}
+}
+
+func drift(args []string) int {
+	fs := flag.NewFlagSet("drift", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: extractor drift -store drift.json [-config name] [flags]")
+		fs.PrintDefaults()
+	}
+	storePath := fs.String("store", "", "drift store written by serve -drift or batch -drift")
+	config := fs.String("config", "", "report only this config")
+	baseline := fs.Duration("baseline", 7*24*time.Hour, "length of the baseline window")
+	current := fs.Duration("current", 24*time.Hour, "length of the current window")
+	fillRateDrop := fs.Float64("fill-drop", 0.2, "flag fields whose fill rate drops by at least this")
+	lengthChange := fs.Float64("length-change", 0.5, "flag fields whose average length changes by at least this ratio")
+	asJSON := fs.Bool("json", false, "print the reports as json")
+	fs.Parse(args)
+	if len(*storePath) == 0 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	store, err := extractor.NewDriftStore(*storePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return exitError
+	}
+	opts := extractor.DriftOptions{
+		Baseline:     *baseline,
+		Current:      *current,
+		FillRateDrop: *fillRateDrop,
+		LengthChange: *lengthChange,
+	}
+	configs := store.Configs()
+	if len(*config) > 0 {
+		configs = []string{*config}
+	}
+
+	drifted := 0
+	now := time.Now()
+	reports := []*extractor.DriftReport{}
+	for _, name := range configs {
+		report := store.Report(name, opts, now)
+		drifted += report.Drifted
+		reports = append(reports, report)
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(reports)
+	} else {
+		for _, report := range reports {
+			printDrift(report)
+		}
+	}
+	if drifted > 0 {
+		return exitExtract
+	}
+	return exitOK
+}
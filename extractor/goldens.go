@@ -0,0 +1,60 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"zhongguo/extractor/golden"
+)
+
+func test(args []string) int {
+	fs := flag.NewFlagSet("test", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: extractor test [-update] ./fixtures")
+		fs.PrintDefaults()
+	}
+	update := fs.Bool("update", false, "rewrite expected.json from the current results")
+	configs := fs.String("configs", "", "directory of named configs for $ref")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	ex := newExtractor()
+	if len(*configs) > 0 {
+		if err := loadLibrary(ex, *configs); err != nil {
+			fmt.Fprintf(os.Stderr, "config: %s\n", err)
+			return exitConfig
+		}
+	}
+	results, err := golden.RunAll(ex, fs.Arg(0), *update)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return exitError
+	}
+
+	failed := 0
+	for _, ret := range results {
+		switch {
+		case ret.Err != nil:
+			failed++
+			fmt.Printf("ERROR  %s: %s\n", ret.Name, ret.Err)
+		case ret.Updated:
+			fmt.Printf("UPDATE %s\n", ret.Name)
+		case len(ret.Diffs) > 0:
+			failed++
+			fmt.Printf("FAIL   %s\n", ret.Name)
+			for _, diff := range ret.Diffs {
+				fmt.Printf("       %s\n", diff)
+			}
+		default:
+			fmt.Printf("PASS   %s\n", ret.Name)
+		}
+	}
+	fmt.Printf("%d fixtures, %d failed\n", len(results), failed)
+	if failed > 0 {
+		return exitExtract
+	}
+	return exitOK
+}
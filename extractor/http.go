@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+	"zhongguo/extractor"
+)
+
+type httpServer struct {
+	ex      *extractor.Extractor
+	rpc2    *rpc2Server
+	maxBody int64
+}
+
+func newHTTPServer(ex *extractor.Extractor, rpc2 *rpc2Server, maxBody int64) *httpServer {
+	return &httpServer{ex: ex, rpc2: rpc2, maxBody: maxBody}
+}
+
+func (self *httpServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/extract", self.extract)
+	mux.HandleFunc("/extract/", self.extract)
+	mux.HandleFunc("/healthz", self.healthz)
+	mux.HandleFunc("/configs", self.configs)
+	mux.HandleFunc("/drift", self.drift)
+	mux.Handle("/rpc", self.rpc2)
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, &extractor.ExtractResponse{Errors: []string{err.Error()}})
+}
+
+func (self *httpServer) healthz(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func (self *httpServer) configs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	status := []extractor.ConfigStatus{}
+	if self.ex.Library != nil {
+		status = self.ex.Library.Status()
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+func (self *httpServer) drift(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	query := r.URL.Query()
+	args := extractor.DriftArgs{
+		Config:   query.Get("config"),
+		Baseline: query.Get("baseline"),
+		Current:  query.Get("current"),
+	}
+	report := extractor.DriftReport{}
+	if err := self.ex.RpcDrift(args, &report); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, &report)
+}
+
+// readRequest accepts a multipart form with the raw document in the "body"
+// file, and otherwise, for named configs, the raw document, whatever its
+// type, as the request body or, on /extract, a JSON ExtractRequest.
+func (self *httpServer) readRequest(r *http.Request, configName string) (*extractor.ExtractRequest, error) {
+	req := &extractor.ExtractRequest{}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch {
+	case mediaType == "multipart/form-data":
+		if err := r.ParseMultipartForm(self.maxBody); err != nil {
+			return nil, err
+		}
+		if config := r.FormValue("config"); len(config) > 0 {
+			if err := json.Unmarshal([]byte(config), &req.Config); err != nil {
+				return nil, fmt.Errorf("config: %v", err)
+			}
+		}
+		if vars := r.FormValue("vars"); len(vars) > 0 {
+			if err := json.Unmarshal([]byte(vars), &req.Vars); err != nil {
+				return nil, fmt.Errorf("vars: %v", err)
+			}
+		}
+		req.ConfigName = r.FormValue("config_name")
+		req.Type = r.FormValue("type")
+		req.BaseURL = r.FormValue("base_url")
+		file, _, err := r.FormFile("body")
+		if err == nil {
+			defer file.Close()
+			if req.Body, err = ioutil.ReadAll(file); err != nil {
+				return nil, err
+			}
+		} else {
+			req.Body = []byte(r.FormValue("body"))
+		}
+	case len(configName) > 0:
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			return nil, err
+		}
+		req.Body = body
+		req.Type = r.URL.Query().Get("type")
+		req.BaseURL = r.URL.Query().Get("base_url")
+	case mediaType == "application/json":
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported content type %s", mediaType)
+	}
+	if len(configName) > 0 {
+		req.Config = nil
+		req.ConfigName = configName
+	}
+	return req, nil
+}
+
+func (self *httpServer) extract(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	configName := strings.Trim(strings.TrimPrefix(r.URL.Path, "/extract"), "/")
+	r.Body = http.MaxBytesReader(w, r.Body, self.maxBody)
+	req, err := self.readRequest(r, configName)
+	if err != nil {
+		status := http.StatusBadRequest
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		writeError(w, status, err)
+		return
+	}
+	resp, err := self.ex.DoRequest(req)
+	status := http.StatusOK
+	if errors.Is(err, extractor.ErrInvalidConfig) {
+		status = http.StatusBadRequest
+	} else if errors.Is(err, extractor.ErrParseBody) {
+		status = http.StatusUnprocessableEntity
+	}
+	writeJSON(w, status, resp)
+}
+
+func (self *httpServer) Server(addr string, readTimeout, writeTimeout time.Duration) *http.Server {
+	return &http.Server{
+		Addr:         addr,
+		Handler:      self.Handler(),
+		ReadTimeout:  readTimeout,
+		WriteTimeout: writeTimeout,
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testServer(t *testing.T) *httptest.Server {
+	dir, err := ioutil.TempDir("", "configs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	ioutil.WriteFile(filepath.Join(dir, "item.json"), []byte(`{"title":"h1"}`), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "api.json"), []byte(`{"_type":"json", "name":"data.name"}`), 0644)
+	ex := newExtractor()
+	if err := loadLibrary(ex, dir); err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(newHTTPServer(ex, newRPC2Server(ex, 2, 1024), 1024).Handler())
+	t.Cleanup(server.Close)
+	return server
+}
+
+func multipartBody(fields map[string]string, body string) (string, *bytes.Buffer) {
+	buf := &bytes.Buffer{}
+	w := multipart.NewWriter(buf)
+	for key, val := range fields {
+		w.WriteField(key, val)
+	}
+	file, _ := w.CreateFormFile("body", "page.html")
+	file.Write([]byte(body))
+	w.Close()
+	return w.FormDataContentType(), buf
+}
+
+func TestHTTPServer(t *testing.T) {
+	server := testServer(t)
+	formType, form := multipartBody(map[string]string{"config": `{"title":"h1"}`}, "<h1>form</h1>")
+	cases := []struct {
+		name, method, path, contentType, body string
+		status                                int
+		contains                              string
+	}{
+		{"healthz", "GET", "/healthz", "", "", 200, `"status":"ok"`},
+		{"healthz method", "POST", "/healthz", "", "", 405, "method not allowed"},
+		{"configs", "GET", "/configs", "", "", 200, `"name":"item"`},
+		{"extract json", "POST", "/extract", "application/json", `{"config":{"title":"h1"},"body":"PGgxPmhpPC9oMT4="}`, 200, `"result":{"title":"hi"}`},
+		{"extract multipart", "POST", "/extract", formType, form.String(), 200, `"result":{"title":"form"}`},
+		{"extract method", "GET", "/extract", "", "", 405, "method not allowed"},
+		{"extract bad json", "POST", "/extract", "application/json", `{"config":`, 400, "errors"},
+		{"extract no config", "POST", "/extract", "application/json", `{"body":""}`, 400, "config or config_name is required"},
+		{"extract content type", "POST", "/extract", "text/plain", "<h1>x</h1>", 400, "unsupported content type"},
+		{"named html", "POST", "/extract/item", "text/html", "<h1>named</h1>", 200, `"result":{"title":"named"}`},
+		{"named json document", "POST", "/extract/api", "application/json", `{"data":{"name":"raw"}}`, 200, `"result":{"name":"raw"}`},
+		{"named unknown", "POST", "/extract/nope", "text/html", "<h1>x</h1>", 400, "nope"},
+		{"too large", "POST", "/extract/item", "text/html", "<h1>" + strings.Repeat("x", 2048) + "</h1>", 413, "too large"},
+		{"too large json", "POST", "/extract", "application/json", `{"body":"` + strings.Repeat("x", 2048) + `"}`, 413, "too large"},
+	}
+	for _, c := range cases {
+		req, _ := http.NewRequest(c.method, server.URL+c.path, strings.NewReader(c.body))
+		if len(c.contentType) > 0 {
+			req.Header.Set("Content-Type", c.contentType)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(c.name, err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != c.status || !strings.Contains(string(body), c.contains) {
+			t.Errorf("%s: %d %s", c.name, resp.StatusCode, body)
+		}
+	}
+}
+
+func TestHTTPMultipartTooLarge(t *testing.T) {
+	server := testServer(t)
+	contentType, body := multipartBody(map[string]string{"config_name": "item"}, strings.Repeat("x", 4096))
+	resp, err := http.Post(server.URL+"/extract", contentType, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	ret := map[string]interface{}{}
+	json.NewDecoder(resp.Body).Decode(&ret)
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Error(resp.StatusCode, ret)
+	}
+}
+
+func TestServeHTTPListenError(t *testing.T) {
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+	dir := writeFiles(t, map[string]string{})
+	drift := filepath.Join(dir, "drift.json")
+	code := serve([]string{"-rpc", "", "-http", busy.Addr().String(), "-drift", drift})
+	if code != exitError {
+		t.Errorf("exit %d", code)
+	}
+	if _, err := os.Stat(drift); err != nil {
+		t.Error("drift store not saved on the way out:", err)
+	}
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sync"
+	"zhongguo/extractor"
+)
+
+const (
+	rpc2ParseError     = -32700
+	rpc2InvalidRequest = -32600
+	rpc2MethodNotFound = -32601
+	rpc2InvalidParams  = -32602
+	rpc2InternalError  = -32603
+
+	rpc2InvalidConfig  = -32001
+	rpc2ParseFailure   = -32002
+	rpc2ExtractFailure = -32003
+
+	rpc2DefaultWorkers = 16
+)
+
+type rpc2Request struct {
+	Version string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+	ID      json.RawMessage `json:"id"`
+}
+
+type rpc2Error struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+type rpc2Response struct {
+	Result interface{}
+	Error  *rpc2Error
+	ID     json.RawMessage
+}
+
+func (self *rpc2Response) MarshalJSON() ([]byte, error) {
+	id := self.ID
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+	if self.Error != nil {
+		return json.Marshal(struct {
+			Version string          `json:"jsonrpc"`
+			Error   *rpc2Error      `json:"error"`
+			ID      json.RawMessage `json:"id"`
+		}{"2.0", self.Error, id})
+	}
+	return json.Marshal(struct {
+		Version string          `json:"jsonrpc"`
+		Result  interface{}     `json:"result"`
+		ID      json.RawMessage `json:"id"`
+	}{"2.0", self.Result, id})
+}
+
+type rpc2Method func(params json.RawMessage) (interface{}, *rpc2Error)
+
+// rpc2Server speaks JSON-RPC 2.0 over tcp and http. The members of a batch
+// are evaluated concurrently by at most workers goroutines.
+type rpc2Server struct {
+	ex      *extractor.Extractor
+	workers int
+	maxBody int64
+	methods map[string]rpc2Method
+}
+
+func newRPC2Server(ex *extractor.Extractor, workers int, maxBody int64) *rpc2Server {
+	if workers <= 0 {
+		workers = rpc2DefaultWorkers
+	}
+	server := &rpc2Server{ex: ex, workers: workers, maxBody: maxBody}
+	server.methods = map[string]rpc2Method{
+		"Extractor.Extract":       server.extract,
+		"Extractor.RpcParse":      server.parse,
+		"Extractor.RpcParseNamed": server.parseNamed,
+		"Extractor.RpcStatus":     server.status,
+		"Extractor.RpcDrift":      server.drift,
+	}
+	return server
+}
+
+func invalidParams(err error) *rpc2Error {
+	return &rpc2Error{Code: rpc2InvalidParams, Message: "Invalid params", Data: err.Error()}
+}
+
+// decodeParams accepts both named params and positional params holding a
+// single value.
+func decodeParams(params json.RawMessage, v interface{}) error {
+	params = bytes.TrimSpace(params)
+	if len(params) == 0 {
+		return errors.New("missing params")
+	}
+	if params[0] == '[' {
+		var positional []json.RawMessage
+		if err := json.Unmarshal(params, &positional); err != nil {
+			return err
+		}
+		if len(positional) != 1 {
+			return errors.New("expected exactly one param")
+		}
+		params = positional[0]
+	}
+	return json.Unmarshal(params, v)
+}
+
+func extractError(err error, data interface{}) *rpc2Error {
+	code := rpc2ExtractFailure
+	if errors.Is(err, extractor.ErrInvalidConfig) {
+		code = rpc2InvalidConfig
+	} else if errors.Is(err, extractor.ErrParseBody) {
+		code = rpc2ParseFailure
+	}
+	return &rpc2Error{Code: code, Message: err.Error(), Data: data}
+}
+
+func (self *rpc2Server) extract(params json.RawMessage) (interface{}, *rpc2Error) {
+	req := &extractor.ExtractRequest{}
+	if err := decodeParams(params, req); err != nil {
+		return nil, invalidParams(err)
+	}
+	resp, err := self.ex.DoRequest(req)
+	if err != nil {
+		return nil, extractError(err, resp)
+	}
+	return resp, nil
+}
+
+func (self *rpc2Server) parse(params json.RawMessage) (interface{}, *rpc2Error) {
+	var args string
+	if err := decodeParams(params, &args); err != nil {
+		return nil, invalidParams(err)
+	}
+	var reply string
+	if err := self.ex.RpcParse(args, &reply); err != nil {
+		return nil, extractError(err, nil)
+	}
+	return reply, nil
+}
+
+func (self *rpc2Server) parseNamed(params json.RawMessage) (interface{}, *rpc2Error) {
+	var args string
+	if err := decodeParams(params, &args); err != nil {
+		return nil, invalidParams(err)
+	}
+	var reply string
+	if err := self.ex.RpcParseNamed(args, &reply); err != nil {
+		return nil, extractError(err, nil)
+	}
+	return reply, nil
+}
+
+func (self *rpc2Server) status(params json.RawMessage) (interface{}, *rpc2Error) {
+	var reply []extractor.ConfigStatus
+	self.ex.RpcStatus("", &reply)
+	return reply, nil
+}
+
+func (self *rpc2Server) drift(params json.RawMessage) (interface{}, *rpc2Error) {
+	args := extractor.DriftArgs{}
+	if err := decodeParams(params, &args); err != nil {
+		return nil, invalidParams(err)
+	}
+	report := &extractor.DriftReport{}
+	if err := self.ex.RpcDrift(args, report); err != nil {
+		return nil, &rpc2Error{Code: rpc2InternalError, Message: err.Error()}
+	}
+	return report, nil
+}
+
+// call evaluates one request object. It returns nil for notifications.
+func (self *rpc2Server) call(raw json.RawMessage) *rpc2Response {
+	req := rpc2Request{}
+	if err := json.Unmarshal(raw, &req); err != nil {
+		return &rpc2Response{Error: &rpc2Error{Code: rpc2InvalidRequest, Message: "Invalid Request"}}
+	}
+	if req.Version != "2.0" || len(req.Method) == 0 {
+		return &rpc2Response{ID: req.ID, Error: &rpc2Error{Code: rpc2InvalidRequest, Message: "Invalid Request"}}
+	}
+	resp := &rpc2Response{ID: req.ID}
+	method, ok := self.methods[req.Method]
+	if !ok {
+		resp.Error = &rpc2Error{Code: rpc2MethodNotFound, Message: "Method not found", Data: req.Method}
+	} else {
+		func() {
+			defer func() {
+				if err := recover(); err != nil {
+					resp.Error = &rpc2Error{Code: rpc2InternalError, Message: "Internal error"}
+				}
+			}()
+			resp.Result, resp.Error = method(req.Params)
+		}()
+	}
+	if req.ID == nil {
+		return nil
+	}
+	return resp
+}
+
+func rpc2Fail(code int, message string) []byte {
+	out, _ := json.Marshal(&rpc2Response{Error: &rpc2Error{Code: code, Message: message}})
+	return out
+}
+
+// Handle evaluates a single request or a batch and returns the encoded
+// response, or nil when there is nothing to answer.
+func (self *rpc2Server) Handle(raw []byte) []byte {
+	raw = bytes.TrimSpace(raw)
+	if !json.Valid(raw) {
+		return rpc2Fail(rpc2ParseError, "Parse error")
+	}
+	if len(raw) == 0 || raw[0] != '[' {
+		resp := self.call(raw)
+		if resp == nil {
+			return nil
+		}
+		out, _ := json.Marshal(resp)
+		return out
+	}
+
+	var batch []json.RawMessage
+	json.Unmarshal(raw, &batch)
+	if len(batch) == 0 {
+		return rpc2Fail(rpc2InvalidRequest, "Invalid Request")
+	}
+	results := make([]*rpc2Response, len(batch))
+	sem := make(chan struct{}, self.workers)
+	wg := sync.WaitGroup{}
+	for i := range batch {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			results[i] = self.call(batch[i])
+		}(i)
+	}
+	wg.Wait()
+
+	responses := []*rpc2Response{}
+	for _, resp := range results {
+		if resp != nil {
+			responses = append(responses, resp)
+		}
+	}
+	if len(responses) == 0 {
+		return nil
+	}
+	out, _ := json.Marshal(responses)
+	return out
+}
+
+// ServeConn reads a stream of JSON values from conn and writes one response
+// line per answered value. Values are handled concurrently, so responses may
+// arrive out of order and must be matched by id.
+func (self *rpc2Server) ServeConn(conn net.Conn) {
+	defer conn.Close()
+	dec := json.NewDecoder(bufio.NewReader(conn))
+	lock := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	write := func(out []byte) {
+		if out == nil {
+			return
+		}
+		lock.Lock()
+		defer lock.Unlock()
+		conn.Write(append(out, '\n'))
+	}
+	for {
+		var raw json.RawMessage
+		err := dec.Decode(&raw)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			write(rpc2Fail(rpc2ParseError, "Parse error"))
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			write(self.Handle(raw))
+		}()
+	}
+	wg.Wait()
+}
+
+func (self *rpc2Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, self.maxBody))
+	if err != nil {
+		writeError(w, http.StatusRequestEntityTooLarge, err)
+		return
+	}
+	out := self.Handle(body)
+	if out == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(out)
+}
+
+func serveRPC2(l net.Listener, server *rpc2Server) {
+	for {
+		conn, err := l.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return
+		} else if err != nil {
+			continue
+		}
+		go server.ServeConn(conn)
+	}
+}
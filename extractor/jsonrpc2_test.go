@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRPC2Handle(t *testing.T) {
+	server := newRPC2Server(newExtractor(), 2, 1024)
+	body := `"PGgxPmhpPC9oMT4="`
+	cases := []struct {
+		name, request, expected string
+	}{
+		{"extract", `{"jsonrpc":"2.0","method":"Extractor.Extract","params":{"config":{"title":"h1"},"body":` + body + `},"id":1}`, `"result":{"result":{"title":"hi"}`},
+		{"positional", `{"jsonrpc":"2.0","method":"Extractor.Extract","params":[{"config":{"title":"h1"},"body":` + body + `}],"id":"a"}`, `"id":"a"`},
+		{"parse error", `{"jsonrpc":`, `{"jsonrpc":"2.0","error":{"code":-32700,"message":"Parse error"},"id":null}`},
+		{"invalid request", `{"method":"Extractor.Extract","id":2}`, `"code":-32600`},
+		{"method not found", `{"jsonrpc":"2.0","method":"Nope","id":3}`, `"code":-32601`},
+		{"invalid params", `{"jsonrpc":"2.0","method":"Extractor.Extract","params":[1,2],"id":4}`, `"code":-32602`},
+		{"invalid config", `{"jsonrpc":"2.0","method":"Extractor.Extract","params":{"body":""},"id":5}`, `"code":-32001`},
+		{"parse failure", `{"jsonrpc":"2.0","method":"Extractor.Extract","params":{"config":{"_type":"json","a":"a"},"body":"bm90IGpzb24="},"id":6}`, `"code":-32002`},
+		{"extract failure", `{"jsonrpc":"2.0","method":"Extractor.Extract","params":{"config":{"_root":"ul","a":"li"},"body":` + body + `},"id":7}`, `"code":-32003`},
+		{"notification", `{"jsonrpc":"2.0","method":"Extractor.RpcStatus"}`, ``},
+		{"empty batch", `[]`, `"code":-32600`},
+		{"batch", `[{"jsonrpc":"2.0","method":"Extractor.RpcStatus","id":1},{"jsonrpc":"2.0","method":"Extractor.RpcStatus"},{"jsonrpc":"2.0","method":"Nope","id":2}]`, `"id":1},{"jsonrpc":"2.0","error":{"code":-32601`},
+		{"batch of notifications", `[{"jsonrpc":"2.0","method":"Extractor.RpcStatus"}]`, ``},
+	}
+	for _, c := range cases {
+		out := string(server.Handle([]byte(c.request)))
+		if len(c.expected) == 0 && len(out) != 0 || !strings.Contains(out, c.expected) {
+			t.Errorf("%s: %s", c.name, out)
+		}
+	}
+}
+
+func TestRPC2HTTPAndTCP(t *testing.T) {
+	server := newRPC2Server(newExtractor(), 2, 64)
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+	for _, c := range []struct {
+		body   string
+		status int
+	}{
+		{`{"jsonrpc":"2.0","method":"Extractor.RpcStatus","id":1}`, 200},
+		{`{"jsonrpc":"2.0","method":"Extractor.RpcStatus"}`, 204},
+		{`{"jsonrpc":"2.0","method":"Extractor.RpcStatus","id":1,"params":"` + strings.Repeat("x", 64) + `"}`, 413},
+	} {
+		resp, err := http.Post(ts.URL, "application/json", strings.NewReader(c.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != c.status {
+			t.Errorf("%s: %d %s", c.body, resp.StatusCode, out)
+		}
+	}
+
+	client, conn := net.Pipe()
+	go server.ServeConn(conn)
+	go func() {
+		client.Write([]byte(`{"jsonrpc":"2.0","method":"Extractor.RpcStatus"}` + "\n" + `{"jsonrpc":"2.0","method":"Extractor.RpcStatus","id":9}`))
+	}()
+	line, err := bufio.NewReader(client).ReadBytes('\n')
+	client.Close()
+	resp := map[string]interface{}{}
+	if err != nil || json.Unmarshal(line, &resp) != nil || resp["id"] != float64(9) {
+		t.Error(string(line), err)
+	}
+}
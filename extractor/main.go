@@ -2,30 +2,63 @@ package main
 
 import (
 	"fmt"
-	"net"
-	"net/rpc"
-	"net/rpc/jsonrpc"
+	"os"
+	"strings"
 	"zhongguo/extractor"
 )
 
+const (
+	exitOK      = 0
+	exitError   = 1
+	exitUsage   = 2
+	exitConfig  = 3
+	exitExtract = 4
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, `usage: extractor <command> [flags]
+
+commands:
+  serve   run the rpc/http server (default when no command is given)
+  run     extract documents given as files or on stdin
+  batch   apply one config to a directory of saved pages
+  test    compare configs against golden fixtures
+  drift   report fields whose results drifted
+  suggest propose a config from example values`)
+}
+
 func main() {
-	rpc.Register(newExtractor())
-	l, err := net.Listen("tcp", ":8585")
-	if err != nil {
-		fmt.Printf("Listener tcp err: %s", err)
-		return
+	args := os.Args[1:]
+	command := "serve"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
 	}
-
-	for {
-		fmt.Println("wating...")
-		conn, err := l.Accept()
-		if err != nil {
-			fmt.Sprintf("accept connection err: %s\n", conn)
-		}
-		go jsonrpc.ServeConn(conn)
+	switch command {
+	case "serve":
+		os.Exit(serve(args))
+	case "run":
+		os.Exit(run(args))
+	case "batch":
+		os.Exit(batch(args))
+	case "test":
+		os.Exit(test(args))
+	case "drift":
+		os.Exit(drift(args))
+	case "suggest":
+		os.Exit(suggest(args))
+	case "help":
+		usage()
+	default:
+		usage()
+		os.Exit(exitUsage)
 	}
 }
 
+func loadLibrary(ex *extractor.Extractor, dir string) error {
+	ex.Library = extractor.NewConfigLibrary(dir)
+	return ex.Library.Load()
+}
+
 func newExtractor() *extractor.Extractor {
 	extractor := extractor.NewExtractor()
 	filter := func(config string) (string, bool) {
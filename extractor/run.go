@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"zhongguo/extractor"
+
+	"golang.org/x/net/html/charset"
+)
+
+type varsFlag map[string]string
+
+func (self varsFlag) String() string {
+	return fmt.Sprint(map[string]string(self))
+}
+
+func (self varsFlag) Set(v string) error {
+	tks := strings.SplitN(v, "=", 2)
+	if len(tks) != 2 {
+		return fmt.Errorf("var %s is not name=value", v)
+	}
+	self[tks[0]] = tks[1]
+	return nil
+}
+
+type output struct {
+	w      io.Writer
+	pretty bool
+	jsonl  bool
+	raw    bool
+}
+
+func (self *output) write(file string, resp *extractor.ExtractResponse) error {
+	if self.jsonl {
+		record := map[string]interface{}{
+			"file":   file,
+			"result": resp.Result,
+		}
+		if len(resp.Errors) > 0 {
+			record["errors"] = resp.Errors
+		}
+		return self.encode(record, false)
+	}
+	if str, ok := resp.Result.(string); ok && self.raw {
+		_, err := fmt.Fprintln(self.w, str)
+		return err
+	}
+	return self.encode(resp.Result, self.pretty)
+}
+
+func (self *output) encode(v interface{}, pretty bool) error {
+	enc := json.NewEncoder(self.w)
+	enc.SetEscapeHTML(false)
+	if pretty {
+		enc.SetIndent("", "  ")
+	}
+	return enc.Encode(v)
+}
+
+func readBody(path, label string) ([]byte, error) {
+	var body []byte
+	var err error
+	if path == "-" {
+		body, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		body, err = ioutil.ReadFile(path)
+	}
+	if err != nil || len(label) == 0 {
+		return body, err
+	}
+	r, err := charset.NewReaderLabel(label, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(r)
+}
+
+// requestTemplate builds the request shared by every document of a command
+// from the common -c/-name/-type/-base-url/-var/-legacy-selectors flags.
+type requestTemplate struct {
+	configFile string
+	configName string
+	configs    string
+	dataType   string
+	baseURL    string
+	charset    string
+	vars       varsFlag
+	legacy     bool
+}
+
+func (self *requestTemplate) bind(fs *flag.FlagSet) {
+	self.vars = varsFlag{}
+	fs.StringVar(&self.configFile, "c", "", "config file (json or yaml)")
+	fs.StringVar(&self.configName, "name", "", "named config from -configs")
+	fs.StringVar(&self.configs, "configs", "", "directory of named configs")
+	fs.StringVar(&self.dataType, "type", "", "override the _type of the config")
+	fs.StringVar(&self.baseURL, "base-url", "", "base url to resolve relative links")
+	fs.StringVar(&self.charset, "charset", "", "charset of the documents, e.g. gbk")
+	fs.Var(self.vars, "var", "variable name=value, repeatable")
+	fs.BoolVar(&self.legacy, "legacy-selectors", false, "split selectors that do not follow the grammar the old way instead of rejecting them")
+}
+
+// name identifies the config in drift statistics.
+func (self *requestTemplate) name() string {
+	if len(self.configName) > 0 {
+		return self.configName
+	}
+	base := filepath.Base(self.configFile)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+func (self *requestTemplate) extractor() (*extractor.Extractor, *extractor.ExtractRequest, error) {
+	ex := newExtractor()
+	ex.LegacySelectors = self.legacy
+	if len(self.configs) > 0 {
+		if err := loadLibrary(ex, self.configs); err != nil {
+			return nil, nil, err
+		}
+	}
+	req := &extractor.ExtractRequest{
+		ConfigName: self.configName,
+		Type:       self.dataType,
+		BaseURL:    self.baseURL,
+		Vars:       self.vars,
+	}
+	if len(self.configFile) > 0 {
+		config, err := extractor.LoadConfigFile(self.configFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		req.Config = config
+	} else if len(self.configName) == 0 {
+		return nil, nil, errors.New("-c or -name is required")
+	}
+	return ex, req, nil
+}
+
+func run(args []string) int {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: extractor run -c config.json [flags] [page.html ...]")
+		fs.PrintDefaults()
+	}
+	tmpl := &requestTemplate{}
+	tmpl.bind(fs)
+	out := &output{w: os.Stdout}
+	fs.BoolVar(&out.pretty, "pretty", false, "indent the json output")
+	fs.BoolVar(&out.jsonl, "jsonl", false, "one json record per document with file and errors")
+	fs.BoolVar(&out.raw, "raw", false, "print string results without json quoting")
+	trace := fs.Bool("trace", false, "print how every field was resolved to stderr")
+	fs.Parse(args)
+
+	ex, req, err := tmpl.extractor()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "config: %s\n", err)
+		return exitConfig
+	}
+	req.Trace = *trace
+	files := fs.Args()
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+
+	code := exitOK
+	for _, file := range files {
+		body, err := readBody(file, tmpl.charset)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", file, err)
+			code = exitError
+			continue
+		}
+		fileReq := *req
+		fileReq.Body = body
+		resp, err := ex.DoRequest(&fileReq)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", file, err)
+			if errors.Is(err, extractor.ErrInvalidConfig) {
+				return exitConfig
+			}
+			code = exitExtract
+		}
+		if resp.Trace != nil {
+			(&output{w: os.Stderr}).encode(resp.Trace, true)
+		}
+		if err == nil || out.jsonl {
+			out.write(file, resp)
+		}
+	}
+	return code
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// captureStdout runs fn with os.Stdout redirected to a file and returns
+// what it printed.
+func captureStdout(t *testing.T, fn func() int) (int, string) {
+	f, err := ioutil.TempFile("", "stdout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	stdout := os.Stdout
+	os.Stdout = f
+	code := fn()
+	os.Stdout = stdout
+	f.Close()
+	out, _ := ioutil.ReadFile(f.Name())
+	return code, string(out)
+}
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "run")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		ioutil.WriteFile(path, []byte(content), 0644)
+	}
+	return dir
+}
+
+func TestRun(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"item.json":   `{"title":"h1"}`,
+		"string.json": `["h1"]`,
+		"list.json":   `{"_root":"ul","name":"li"}`,
+		"bad.json":    `{"title":`,
+		"legacy.json": `{"title":"h1;;(\\w+);x"}`,
+		"a.html":      `<h1>A</h1>`,
+		"b.html":      `<p>none</p>`,
+		"gbk.html":    "<h1>\xd6\xd0\xce\xc4</h1>",
+	})
+	path := func(name string) string {
+		return filepath.Join(dir, name)
+	}
+	cases := []struct {
+		name   string
+		args   []string
+		code   int
+		output string
+	}{
+		{"json", []string{"-c", path("item.json"), path("a.html")}, exitOK, "{\"title\":\"A\"}\n"},
+		{"pretty", []string{"-c", path("item.json"), "-pretty", path("a.html")}, exitOK, "{\n  \"title\": \"A\"\n}\n"},
+		{"raw", []string{"-c", path("string.json"), "-raw", path("a.html")}, exitOK, "A\n"},
+		{"quoted", []string{"-c", path("string.json"), path("a.html")}, exitOK, "\"A\"\n"},
+		{"charset", []string{"-c", path("item.json"), "-charset", "gbk", path("gbk.html")}, exitOK, "{\"title\":\"中文\"}\n"},
+		{"jsonl", []string{"-c", path("item.json"), "-jsonl", path("a.html"), path("b.html")}, exitOK,
+			"{\"file\":\"" + path("a.html") + "\",\"result\":{\"title\":\"A\"}}\n{\"file\":\"" + path("b.html") + "\",\"result\":{\"title\":null}}\n"},
+		{"jsonl errors", []string{"-c", path("list.json"), "-jsonl", path("a.html")}, exitExtract,
+			"{\"errors\":[\"extract error: return nil\"],\"file\":\"" + path("a.html") + "\",\"result\":null}\n"},
+		{"extract error", []string{"-c", path("list.json"), path("a.html")}, exitExtract, ""},
+		{"missing file", []string{"-c", path("item.json"), path("none.html")}, exitError, ""},
+		{"no config", []string{path("a.html")}, exitConfig, ""},
+		{"bad config", []string{"-c", path("bad.json"), path("a.html")}, exitConfig, ""},
+		{"invalid config", []string{"-c", path("item.json"), "-type", "pdf", path("a.html")}, exitConfig, ""},
+		{"invalid selector", []string{"-c", path("legacy.json"), path("a.html")}, exitConfig, ""},
+		{"legacy selectors", []string{"-c", path("legacy.json"), "-legacy-selectors", path("a.html")}, exitOK, "{\"title\":\"A\"}\n"},
+	}
+	for _, c := range cases {
+		code, out := captureStdout(t, func() int { return run(c.args) })
+		if code != c.code || out != c.output {
+			t.Errorf("%s: %d %q", c.name, code, out)
+		}
+	}
+}
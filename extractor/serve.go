@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+	"zhongguo/extractor"
+)
+
+func serve(args []string) int {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	configs := fs.String("configs", "", "directory of named configs")
+	reload := fs.Duration("reload", 5*time.Second, "interval to reload named configs")
+	rpcAddr := fs.String("rpc", ":8585", "json-rpc listen address, empty to disable")
+	rpc2Addr := fs.String("rpc2", "", "json-rpc 2.0 listen address, empty to disable")
+	httpAddr := fs.String("http", "", "http listen address, empty to disable")
+	batchWorkers := fs.Int("batch-workers", 16, "concurrent calls per json-rpc 2.0 batch")
+	maxBody := fs.Int64("max-body", 32<<20, "max http request size in bytes")
+	readTimeout := fs.Duration("read-timeout", 30*time.Second, "http read timeout")
+	writeTimeout := fs.Duration("write-timeout", 60*time.Second, "http write timeout")
+	shutdownTimeout := fs.Duration("shutdown-timeout", 10*time.Second, "graceful shutdown timeout")
+	driftPath := fs.String("drift", "", "record field statistics of named configs into this drift store")
+	driftSave := fs.Duration("drift-save", time.Minute, "interval to save the drift store")
+	legacySelectors := fs.Bool("legacy-selectors", false, "split selectors that do not follow the grammar the old way instead of rejecting them")
+	fs.Parse(args)
+
+	ex := newExtractor()
+	ex.LegacySelectors = *legacySelectors
+	if len(*configs) > 0 {
+		if err := loadLibrary(ex, *configs); err != nil {
+			fmt.Printf("load configs err: %s\n", err)
+			return exitConfig
+		}
+		if *reload > 0 {
+			ex.Library.Watch(*reload)
+			defer ex.Library.Close()
+		}
+	}
+
+	if len(*driftPath) > 0 {
+		store, err := extractor.NewDriftStore(*driftPath)
+		if err != nil {
+			fmt.Printf("load drift store err: %s\n", err)
+			return exitError
+		}
+		ex.Drift = store
+		go func() {
+			for range time.Tick(*driftSave) {
+				if err := store.Save(); err != nil {
+					fmt.Printf("save drift store err: %s\n", err)
+				}
+			}
+		}()
+		defer store.Save()
+	}
+
+	var rpcListener net.Listener
+	if len(*rpcAddr) > 0 {
+		rpc.Register(ex)
+		l, err := net.Listen("tcp", *rpcAddr)
+		if err != nil {
+			fmt.Printf("Listener tcp err: %s\n", err)
+			return exitError
+		}
+		rpcListener = l
+		go serveRPC(l)
+	}
+
+	rpc2 := newRPC2Server(ex, *batchWorkers, *maxBody)
+	var rpc2Listener net.Listener
+	if len(*rpc2Addr) > 0 {
+		l, err := net.Listen("tcp", *rpc2Addr)
+		if err != nil {
+			fmt.Printf("Listener tcp err: %s\n", err)
+			return exitError
+		}
+		rpc2Listener = l
+		go serveRPC2(l, rpc2)
+	}
+
+	// a server that stops on its own ends the command through the same
+	// shutdown path as a signal, so the drift store is still saved
+	failed := make(chan error, 1)
+	var httpSrv *http.Server
+	if len(*httpAddr) > 0 {
+		httpSrv = newHTTPServer(ex, rpc2, *maxBody).Server(*httpAddr, *readTimeout, *writeTimeout)
+		go func() {
+			fmt.Printf("http listening on %s\n", *httpAddr)
+			if err := httpSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				failed <- err
+			}
+		}()
+	}
+
+	if rpcListener == nil && rpc2Listener == nil && httpSrv == nil {
+		fmt.Println("nothing to serve, set -rpc, -rpc2 or -http")
+		return exitUsage
+	}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGTERM, syscall.SIGINT)
+	code := exitOK
+	select {
+	case <-sig:
+	case err := <-failed:
+		fmt.Printf("http serve err: %s\n", err)
+		code = exitError
+	}
+	fmt.Println("shutting down...")
+	if rpcListener != nil {
+		rpcListener.Close()
+	}
+	if rpc2Listener != nil {
+		rpc2Listener.Close()
+	}
+	if httpSrv != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+		defer cancel()
+		if err := httpSrv.Shutdown(ctx); err != nil {
+			fmt.Printf("http shutdown err: %s\n", err)
+		}
+	}
+	return code
+}
+
+func serveRPC(l net.Listener) {
+	for {
+		fmt.Println("wating...")
+		conn, err := l.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return
+		} else if err != nil {
+			fmt.Printf("accept connection err: %s\n", err)
+			continue
+		}
+		go jsonrpc.ServeConn(conn)
+	}
+}
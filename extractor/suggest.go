@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"zhongguo/extractor"
+)
+
+func suggest(args []string) int {
+	fs := flag.NewFlagSet("suggest", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: extractor suggest -e examples.json [page.html]")
+		fs.PrintDefaults()
+	}
+	examplesFile := fs.String("e", "", `example values, e.g. {"price": "199.00", "name": ["first", "second"]}`)
+	charset := fs.String("charset", "", "charset of the page, e.g. gbk")
+	fs.Parse(args)
+	if len(*examplesFile) == 0 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	data, err := ioutil.ReadFile(*examplesFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return exitError
+	}
+	examples := map[string]interface{}{}
+	if err := json.Unmarshal(data, &examples); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", *examplesFile, err)
+		return exitUsage
+	}
+	file := "-"
+	if fs.NArg() > 0 {
+		file = fs.Arg(0)
+	}
+	body, err := readBody(file, *charset)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", file, err)
+		return exitError
+	}
+
+	config, missing, err := extractor.Suggest(body, examples)
+	if len(missing) > 0 {
+		fmt.Fprintf(os.Stderr, "not found: %s\n", strings.Join(missing, ", "))
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return exitExtract
+	}
+	(&output{w: os.Stdout}).encode(config, true)
+	return exitOK
+}
@@ -134,10 +134,12 @@ func (self *Extractor) extractJson(config interface{}, json *simplejson.Json) in
 				v = val
 			}
 		}
+		v = self.vars(v)
 		val := self.ExtractJsonSingle(v, json)
 		if val == "" {
 			val = nil
 		}
+		self.traceValue(val)
 		return val
 	}
 
@@ -151,41 +153,54 @@ func (self *Extractor) extractJson(config interface{}, json *simplejson.Json) in
 		if len(rt) > 0 {
 			doc = GetJsonPath(rt, doc)
 			if doc == nil {
+				self.traceRoot(rt, 0)
+				self.traceJsonSteps(rt, json)
 				return nil
 			}
+			if length, yes := isJsonArray(doc); yes {
+				self.traceRoot(rt, length)
+			} else {
+				self.traceRoot(rt, 1)
+			}
 		}
 		if isEmptyParse(m) {
 			return doc.Interface()
 		}
 		length, yes := isJsonArray(doc)
 		if yes == false {
-			ret := make(map[string]interface{})
-			for key, val := range m {
-				if strings.HasPrefix(key, "_") {
-					continue
-				}
-				ret[key] = self.extractJson(val, doc)
+			if len(rt) > 0 && hasShape(m) {
+				return shape(m, []map[string]interface{}{self.extractJsonRecord(m, doc)})
 			}
-			return ret
+			return self.extractJsonRecord(m, doc)
 		} else {
 			ret := []map[string]interface{}{}
 			for i := 0; i < length; i++ {
-				sub := make(map[string]interface{})
-				for key, val := range m {
-					if strings.HasPrefix(key, "_") {
-						continue
-					}
-					stmp := doc.GetIndex(i)
-					sub[key] = self.extractJson(val, stmp)
-				}
+				leaveItem := self.traceEnter("[" + strconv.Itoa(i) + "]")
+				sub := self.extractJsonRecord(m, doc.GetIndex(i))
+				leaveItem()
 				ret = append(ret, sub)
 			}
-			return ret
+			return shape(m, ret)
 		}
 	}
 	return nil
 }
 
+func (self *Extractor) extractJsonRecord(m map[string]interface{}, json *simplejson.Json) map[string]interface{} {
+	ret := make(map[string]interface{})
+	defer self.enterRecord(m, ret)()
+	for _, key := range nestedLast(m) {
+		if strings.HasPrefix(key, "_") {
+			continue
+		}
+		leave := self.traceEnter(key)
+		ret[key] = self.extractJson(m[key], json)
+		leave()
+	}
+	self.computeFields()
+	return ret
+}
+
 func UnMarshal(json *simplejson.Json) *simplejson.Json {
 	val, err := json.String()
 	if len(val) > 0 {
@@ -215,21 +230,20 @@ type JsonSelector struct {
 }
 
 func NewJsonSelector(v string) *JsonSelector {
-	ret := &JsonSelector{}
-	if strings.Contains(v, ">|") {
-		tks := strings.Split(v, ">|")
-		v = tks[0]
-		ret.Template = tks[1]
-	}
-	tks := strings.Split(v, ";")
-	ret.JsonKey = tks[0]
-	if len(tks) > 1 && tks[1] == "true" {
-		ret.UnMarshal = true
-	}
-	if len(tks) > 2 {
-		ret.Regex = tks[2]
+	return newJsonSelector(parseSelector(v, false))
+}
+
+func (self *Extractor) jsonSelector(v string) *JsonSelector {
+	return newJsonSelector(parseSelector(v, self.LegacySelectors))
+}
+
+func newJsonSelector(ast *SelectorAST) *JsonSelector {
+	return &JsonSelector{
+		JsonKey:   ast.Path.text(),
+		Template:  ast.Template.text(),
+		UnMarshal: ast.Attr.text() == "true",
+		Regex:     ast.Regex.text(),
 	}
-	return ret
 }
 
 func (self *Extractor) ExtractJsonSingle(v string, json *simplejson.Json) interface{} {
@@ -237,13 +251,20 @@ func (self *Extractor) ExtractJsonSingle(v string, json *simplejson.Json) interf
 		return json.Interface()
 	}
 	var ret interface{}
-	sel := NewJsonSelector(v)
+	sel := self.jsonSelector(v)
 
 	if len(sel.JsonKey) > 0 {
 		b := GetJsonPath(sel.JsonKey, json)
 		if sel.UnMarshal && b != nil {
 			b = UnMarshal(b)
 		}
+		if b == nil {
+			self.traceSelector(v, 0)
+			self.traceJsonSteps(sel.JsonKey, json)
+		} else {
+			self.traceSelector(v, 1)
+			self.traceJson(b)
+		}
 		if b != nil {
 			if str, err := b.String(); err == nil {
 				ret = str
@@ -265,6 +286,7 @@ func (self *Extractor) ExtractJsonSingle(v string, json *simplejson.Json) interf
 			dlog.Warn("path:%s not found value", v)
 			return ""
 		}
+		self.traceRaw(ret)
 
 		if len(sel.Template) > 0 {
 			ret = self.DoTemplate(sel.Template, ret.(string))
@@ -273,6 +295,7 @@ func (self *Extractor) ExtractJsonSingle(v string, json *simplejson.Json) interf
 
 	if len(sel.Regex) > 0 {
 		ret, _ = Regex(sel.Regex, ret.(string))
+		self.traceRegex(sel.Regex, ret)
 	}
 
 	return ret
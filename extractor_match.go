@@ -0,0 +1,227 @@
+package extractor
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/bitly/go-simplejson"
+	"github.com/xlvector/dlog"
+)
+
+type matchContext struct {
+	body []byte
+	doc  *goquery.Selection
+	json *simplejson.Json
+}
+
+func (self *matchContext) html() *goquery.Selection {
+	if self.doc == nil {
+		doc, err := goquery.NewDocumentFromReader(bytes.NewReader(self.body))
+		if err != nil {
+			dlog.Warn("%s", err.Error())
+			return nil
+		}
+		self.doc = doc.First()
+	}
+	return self.doc
+}
+
+func (self *matchContext) jsonDoc() *simplejson.Json {
+	if self.json == nil {
+		jsonBody := FilterJSONP(string(self.body))
+		json, err := simplejson.NewFromReader(strings.NewReader(jsonBody))
+		if err != nil {
+			dlog.Warn("%s", err.Error())
+			return nil
+		}
+		self.json = json
+	}
+	return self.json
+}
+
+func (self *Extractor) matchCondition(cond, dataType string, ctx *matchContext) bool {
+	if strings.HasPrefix(cond, "@regex ") {
+		reg, err := regexp.Compile(strings.TrimPrefix(cond, "@regex "))
+		if err != nil {
+			dlog.Warn("match regex %s error %v", cond, err)
+			return false
+		}
+		return reg.Match(ctx.body)
+	}
+	switch dataType {
+	case "json":
+		json := ctx.jsonDoc()
+		return json != nil && GetJsonPath(cond, json) != nil
+	case "string":
+		reg, err := regexp.Compile(cond)
+		if err != nil {
+			dlog.Warn("match regex %s error %v", cond, err)
+			return false
+		}
+		return reg.Match(ctx.body)
+	default:
+		doc := ctx.html()
+		if doc == nil {
+			return false
+		}
+		b := queryXpath(cond, doc)
+		return b != nil && b.Size() > 0
+	}
+}
+
+// match reports whether the _match conditions of a candidate config hold for
+// the body. All conditions of a list must hold. The second result is false
+// when the candidate has no _match at all.
+func (self *Extractor) match(m map[string]interface{}, ctx *matchContext) (bool, bool) {
+	cond, ok := m[MATCH_DEFINE]
+	if !ok {
+		return false, false
+	}
+	dataType := self.dataType(m)
+	switch c := cond.(type) {
+	case string:
+		return self.matchCondition(c, dataType, ctx), true
+	case []interface{}:
+		for _, single := range c {
+			s, ok := single.(string)
+			if !ok || !self.matchCondition(s, dataType, ctx) {
+				return false, true
+			}
+		}
+		return true, true
+	}
+	dlog.Warn("unsupported _match %v", cond)
+	return false, true
+}
+
+// DoSelect runs the best of several candidate configs against body and
+// returns its result together with the index of the chosen candidate, or -1
+// when nothing could be chosen. The first candidate whose _match holds wins;
+// otherwise the candidates without _match are scored by field fill rate.
+func (self *Extractor) DoSelect(configs []interface{}, body []byte) (interface{}, int) {
+	ret, index, err := self.selectConfig(configs, body)
+	if err != nil {
+		dlog.Warn("%s", err.Error())
+	}
+	return ret, index
+}
+
+// selectConfig is DoSelect with the error of a failed candidate: that of
+// the matched one, or the first error when no unconditional candidate
+// could be parsed.
+func (self *Extractor) selectConfig(configs []interface{}, body []byte) (interface{}, int, error) {
+	ctx := &matchContext{body: body}
+	unconditional := []int{}
+	for i, config := range configs {
+		m, ok := config.(map[string]interface{})
+		if !ok {
+			unconditional = append(unconditional, i)
+			continue
+		}
+		matched, hasMatch := self.match(m, ctx)
+		if matched {
+			ret, err := self.Parse(config, body)
+			if err != nil {
+				return nil, -1, fmt.Errorf("_select candidate %d: %w", i, err)
+			}
+			return ret, i, nil
+		} else if !hasMatch {
+			unconditional = append(unconditional, i)
+		}
+	}
+
+	best := -1
+	bestScore := -1.0
+	var bestResult interface{}
+	var firstErr error
+	for _, i := range unconditional {
+		ret, err := self.Parse(configs[i], body)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("_select candidate %d: %w", i, err)
+			}
+			continue
+		}
+		filled, total := FillRate(ret)
+		score := 0.0
+		if total > 0 {
+			score = float64(filled) / float64(total)
+		}
+		if score > bestScore {
+			best, bestScore, bestResult = i, score, ret
+		}
+	}
+	if best < 0 {
+		if firstErr != nil {
+			return nil, -1, firstErr
+		}
+		dlog.Warn("no candidate config matched")
+	}
+	return bestResult, best, nil
+}
+
+func (self *Extractor) doSelect(m map[string]interface{}, body []byte) (interface{}, error) {
+	configs, ok := m[SELECT_DEFINE].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%w: _select must be an array of configs", ErrInvalidConfig)
+	}
+	ret, index, err := self.selectConfig(configs, body)
+	if err != nil || index < 0 {
+		return nil, err
+	}
+	selected := map[string]interface{}{
+		"selected": index,
+		"result":   ret,
+	}
+	if c, ok := configs[index].(map[string]interface{}); ok {
+		if name, ok := c[NAME_DEFINE]; ok {
+			selected["name"] = name
+		}
+	}
+	return selected, nil
+}
+
+// FillRate counts the leaf values of an extraction result and how many of
+// them are filled, i.e. neither nil nor empty. The result of an _error
+// detector, a map[string]string, counts as nothing filled.
+func FillRate(v interface{}) (int, int) {
+	var subs []interface{}
+	switch val := v.(type) {
+	case nil, map[string]string:
+		return 0, 1
+	case string:
+		if len(val) == 0 {
+			return 0, 1
+		}
+		return 1, 1
+	case []string:
+		if len(val) == 0 {
+			return 0, 1
+		}
+		return 1, 1
+	case map[string]interface{}:
+		for _, sub := range val {
+			subs = append(subs, sub)
+		}
+	case []map[string]interface{}:
+		for _, sub := range val {
+			subs = append(subs, sub)
+		}
+	case []interface{}:
+		subs = val
+	default:
+		return 1, 1
+	}
+	if len(subs) == 0 {
+		return 0, 1
+	}
+	filled, total := 0, 0
+	for _, sub := range subs {
+		f, t := FillRate(sub)
+		filled, total = filled+f, total+t
+	}
+	return filled, total
+}
@@ -0,0 +1,74 @@
+package extractor
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestDoSelect(t *testing.T) {
+	extractor := NewExtractor()
+	config := `
+				{
+                    "_select":[
+                        {"_name":"mobile", "_match":".m-title", "title":".m-title"},
+                        {"_name":"desktop", "_match":"#title", "title":"#title"}
+                    ]
+                }
+	`
+	data := []byte(`<html><body><h1 id="title">desktop</h1></body></html>`)
+	m := map[string]interface{}{}
+	json.Unmarshal([]byte(config), &m)
+	ret := extractor.Do(m, data).(map[string]interface{})
+	if ret["name"] != "desktop" || ret["selected"] != 1 {
+		t.Error(ret)
+	}
+	t.Log(ret)
+}
+
+func TestDoSelectFillRate(t *testing.T) {
+	extractor := NewExtractor()
+	configs := []interface{}{
+		map[string]interface{}{"title": ".m-title", "price": ".m-price"},
+		map[string]interface{}{"title": "#title", "price": ".m-price"},
+	}
+	data := []byte(`<html><body><h1 id="title">desktop</h1></body></html>`)
+	ret, index := extractor.DoSelect(configs, data)
+	if index != 1 {
+		t.Error(index, ret)
+	}
+	t.Log(ret)
+}
+
+func TestFillRateError(t *testing.T) {
+	extractor := NewExtractor()
+	configs := []interface{}{
+		map[string]interface{}{"_error": ".missing", "title": "h1"},
+		map[string]interface{}{"title": ".m-title", "price": "#price"},
+	}
+	data := []byte(`<html><body><h1 id="title">desktop</h1><b id="price">9</b></body></html>`)
+	if ret, index := extractor.DoSelect(configs, data); index != 1 {
+		t.Error(index, ret)
+	}
+	if filled, total := FillRate(map[string]string{"error": "页面错误"}); filled != 0 || total != 1 {
+		t.Error(filled, total)
+	}
+}
+
+func TestDoSelectErrors(t *testing.T) {
+	data := []byte(`<html><body><h1 id="title">desktop</h1></body></html>`)
+	cases := map[string]error{
+		`{"_select":[{"_match":"#title", "_type":"pdf", "title":"#title"}]}`:    ErrInvalidConfig,
+		`{"_select":[{"_type":"json", "title":"title"}, {"title":"h1 @nope"}]}`: ErrParseBody,
+		`{"_select":[{"_type":"json", "title":"title"}, {"title":"#title"}]}`:   nil,
+		`{"_select":{"title":"#title"}}`:                                        ErrInvalidConfig,
+	}
+	for config, want := range cases {
+		m := map[string]interface{}{}
+		json.Unmarshal([]byte(config), &m)
+		ret, err := NewExtractor().Parse(m, data)
+		if want == nil && (err != nil || ret.(map[string]interface{})["selected"] != 1) || want != nil && !errors.Is(err, want) {
+			t.Errorf("%s: %v %v", config, ret, err)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package extractor
 
 import (
+	"strconv"
 	"strings"
 )
 
@@ -13,13 +14,19 @@ func (self *Extractor) extractString(config interface{}, body string) interface{
 				v = val
 			}
 		}
+		v = self.vars(v)
 		val, array := Regex(v, body)
 		if array != nil {
+			self.traceSelector(v, len(array))
+			self.traceValue(array)
 			return array
 		}
 		if len(val) == 0 {
+			self.traceSelector(v, 0)
 			return nil
 		}
+		self.traceSelector(v, 1)
+		self.traceValue(val)
 		return val
 	}
 
@@ -27,28 +34,33 @@ func (self *Extractor) extractString(config interface{}, body string) interface{
 		rt := self.root(m)
 		if len(rt) > 0 {
 			segment := FindGroupsByIndex(rt, body, 0)
+			self.traceRoot(rt, len(segment))
 			ret := []map[string]interface{}{}
-			for _, seg := range segment {
-				item := make(map[string]interface{})
-				for key, val := range m {
-					if strings.HasPrefix(key, "_") {
-						continue
-					}
-					item[key] = self.extractString(val, seg)
-				}
+			for i, seg := range segment {
+				leaveItem := self.traceEnter("[" + strconv.Itoa(i) + "]")
+				item := self.extractStringRecord(m, seg)
+				leaveItem()
 				ret = append(ret, item)
 			}
-			return ret
+			return shape(m, ret)
 		} else {
-			ret := make(map[string]interface{})
-			for key, val := range m {
-				if strings.HasPrefix(key, "_") {
-					continue
-				}
-				ret[key] = self.extractString(val, body)
-			}
-			return ret
+			return self.extractStringRecord(m, body)
 		}
 	}
 	return nil
 }
+
+func (self *Extractor) extractStringRecord(m map[string]interface{}, body string) map[string]interface{} {
+	ret := make(map[string]interface{})
+	defer self.enterRecord(m, ret)()
+	for _, key := range nestedLast(m) {
+		if strings.HasPrefix(key, "_") {
+			continue
+		}
+		leave := self.traceEnter(key)
+		ret[key] = self.extractString(m[key], body)
+		leave()
+	}
+	self.computeFields()
+	return ret
+}
@@ -29,3 +29,30 @@ func TestPPD(t *testing.T) {
 	ret := extractor.Do(m, data)
 	t.Log(ret)
 }
+
+func TestAllModifier(t *testing.T) {
+	body := []byte(`<html><body>
+		<ul class="tags"><li>go</li><li> html </li><li></li><li>go</li></ul>
+		<img src="/a.png"><img src="//cdn.example.com/b.png"><img>
+		<p class="price">￥12.50</p><p class="price">￥8</p>
+		</body></html>`)
+	config := `{
+		"tags":"ul.tags li@all",
+		"clean":"ul.tags li@all(unique,noempty)",
+		"images":"img@all(noempty);src",
+		"prices":"p.price@all;;￥([0-9.]+)>|{{.}}元"
+	}`
+	m := map[string]interface{}{}
+	json.Unmarshal([]byte(config), &m)
+	extractor := NewExtractor()
+	extractor.BaseURL = "http://www.example.com/list"
+	extractor.DoTemplate = func(template, v string) string {
+		return strings.Replace(template, "{{.}}", v, -1)
+	}
+	ret := extractor.Do(m, body)
+	out, _ := json.Marshal(ret)
+	expected := `{"clean":["go","html"],"images":["http://www.example.com/a.png","http://cdn.example.com/b.png"],"prices":["12.50元","8元"],"tags":["go","html","","go"]}`
+	if string(out) != expected {
+		t.Error(string(out))
+	}
+}
@@ -0,0 +1,395 @@
+// Package golden runs extraction configs against saved pages and compares
+// the results with expected.json goldens.
+//
+// A fixture is a directory holding page.* (the saved document), config.json
+// or config.yaml, expected.json and optionally tolerance.json:
+//
+//	{
+//	    "ignore":  ["$.crawled_at", "$.items[*].stock"],
+//	    "regex":   {"$.price": "^\\d+\\.\\d{2}$"},
+//	    "present": ["$.title"]
+//	}
+//
+// Ignored paths are not compared, regex paths only need to match the
+// pattern and present paths only need a non-empty value. When several regex
+// paths match, the first one in tolerance.json wins.
+package golden
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"zhongguo/extractor"
+)
+
+const (
+	ExpectedFile  = "expected.json"
+	ToleranceFile = "tolerance.json"
+)
+
+type Tolerance struct {
+	Ignore  []string   `json:"ignore"`
+	Regex   RegexRules `json:"regex"`
+	Present []string   `json:"present"`
+}
+
+// RegexRule asks the value at Path to match Pattern.
+type RegexRule struct {
+	Path    string
+	Pattern string
+}
+
+// RegexRules reads and writes the regex object of tolerance.json keeping
+// the order of its keys.
+type RegexRules []RegexRule
+
+func (self *RegexRules) UnmarshalJSON(data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if tk, err := dec.Token(); err != nil {
+		return err
+	} else if tk == nil {
+		*self = nil
+		return nil
+	} else if tk != json.Delim('{') {
+		return fmt.Errorf("regex wants an object of path to pattern, got %v", tk)
+	}
+	rules := RegexRules{}
+	for dec.More() {
+		tk, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		rule := RegexRule{Path: tk.(string)}
+		if err := dec.Decode(&rule.Pattern); err != nil {
+			return err
+		}
+		rules = append(rules, rule)
+	}
+	*self = rules
+	return nil
+}
+
+func (self RegexRules) MarshalJSON() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	buf.WriteByte('{')
+	for i, rule := range self {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		path, _ := json.Marshal(rule.Path)
+		pattern, _ := json.Marshal(rule.Pattern)
+		buf.Write(path)
+		buf.WriteByte(':')
+		buf.Write(pattern)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+type Diff struct {
+	Path     string      `json:"path"`
+	Expected interface{} `json:"expected"`
+	Actual   interface{} `json:"actual"`
+	Message  string      `json:"message"`
+}
+
+func (self Diff) String() string {
+	return fmt.Sprintf("%s: %s (expected %s, got %s)", self.Path, self.Message, encode(self.Expected), encode(self.Actual))
+}
+
+type Result struct {
+	Name    string
+	Diffs   []Diff
+	Err     error
+	Updated bool
+}
+
+func (self *Result) Passed() bool {
+	return self.Err == nil && len(self.Diffs) == 0
+}
+
+func encode(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	if runes := []rune(string(data)); len(runes) > 80 {
+		return string(runes[:80]) + "..."
+	}
+	return string(data)
+}
+
+// Find returns every fixture directory below root.
+func Find(root string) ([]string, error) {
+	dirs := []string{}
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		if configFile(path) != "" && pageFile(path) != "" {
+			dirs = append(dirs, path)
+		}
+		return nil
+	})
+	sort.Strings(dirs)
+	return dirs, err
+}
+
+func configFile(dir string) string {
+	for _, name := range []string{"config.json", "config.yaml", "config.yml"} {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+func pageFile(dir string) string {
+	matches, _ := filepath.Glob(filepath.Join(dir, "page.*"))
+	if len(matches) == 0 {
+		return ""
+	}
+	return matches[0]
+}
+
+func readJSON(path string, v interface{}) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// normalize gives an extraction result the shape it has in a json file.
+func normalize(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var ret interface{}
+	err = json.Unmarshal(data, &ret)
+	return ret, err
+}
+
+// Run extracts the page of one fixture and compares the result with its
+// golden. With update the golden is rewritten instead.
+func Run(ex *extractor.Extractor, dir string, update bool) *Result {
+	ret := &Result{Name: dir}
+	config, err := extractor.LoadConfigFile(configFile(dir))
+	if err != nil {
+		ret.Err = err
+		return ret
+	}
+	body, err := ioutil.ReadFile(pageFile(dir))
+	if err != nil {
+		ret.Err = err
+		return ret
+	}
+	result, err := ex.Parse(config, body)
+	if err != nil {
+		ret.Err = err
+		return ret
+	}
+	actual, err := normalize(result)
+	if err != nil {
+		ret.Err = err
+		return ret
+	}
+
+	expectedPath := filepath.Join(dir, ExpectedFile)
+	if update {
+		data, err := json.MarshalIndent(actual, "", "  ")
+		if err != nil {
+			ret.Err = err
+			return ret
+		}
+		ret.Err = ioutil.WriteFile(expectedPath, append(data, '\n'), 0644)
+		ret.Updated = ret.Err == nil
+		return ret
+	}
+
+	var expected interface{}
+	if err := readJSON(expectedPath, &expected); err != nil {
+		ret.Err = err
+		return ret
+	}
+	tolerance := &Tolerance{}
+	if _, err := os.Stat(filepath.Join(dir, ToleranceFile)); err == nil {
+		if err := readJSON(filepath.Join(dir, ToleranceFile), tolerance); err != nil {
+			ret.Err = err
+			return ret
+		}
+	}
+	ret.Diffs, ret.Err = Compare(expected, actual, tolerance)
+	return ret
+}
+
+func RunAll(ex *extractor.Extractor, root string, update bool) ([]*Result, error) {
+	dirs, err := Find(root)
+	if err != nil {
+		return nil, err
+	}
+	results := []*Result{}
+	for _, dir := range dirs {
+		results = append(results, Run(ex, dir, update))
+	}
+	return results, nil
+}
+
+type regexRule struct {
+	path    *regexp.Regexp
+	pattern *regexp.Regexp
+}
+
+type comparer struct {
+	ignore  []*regexp.Regexp
+	regex   []regexRule
+	present []*regexp.Regexp
+	diffs   []Diff
+}
+
+// pathPattern compiles a tolerance path where [*] matches any index.
+func pathPattern(path string) (*regexp.Regexp, error) {
+	if !strings.HasPrefix(path, "$") {
+		path = "$." + path
+	}
+	pattern := regexp.QuoteMeta(path)
+	pattern = strings.Replace(pattern, `\[\*\]`, `\[\d+\]`, -1)
+	return regexp.Compile("^" + pattern + "$")
+}
+
+func compilePaths(paths []string) ([]*regexp.Regexp, error) {
+	ret := []*regexp.Regexp{}
+	for _, path := range paths {
+		reg, err := pathPattern(path)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, reg)
+	}
+	return ret, nil
+}
+
+func matchAny(patterns []*regexp.Regexp, path string) bool {
+	for _, reg := range patterns {
+		if reg.MatchString(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// Compare returns the structural differences between expected and actual,
+// each located by a json path such as $.items[2].price.
+func Compare(expected, actual interface{}, tolerance *Tolerance) ([]Diff, error) {
+	c := &comparer{}
+	var err error
+	if tolerance != nil {
+		if c.ignore, err = compilePaths(tolerance.Ignore); err != nil {
+			return nil, err
+		}
+		if c.present, err = compilePaths(tolerance.Present); err != nil {
+			return nil, err
+		}
+		for _, rule := range tolerance.Regex {
+			path, err := pathPattern(rule.Path)
+			if err != nil {
+				return nil, err
+			}
+			pattern, err := regexp.Compile(rule.Pattern)
+			if err != nil {
+				return nil, err
+			}
+			c.regex = append(c.regex, regexRule{path, pattern})
+		}
+	}
+	c.compare("$", expected, actual)
+	return c.diffs, nil
+}
+
+func (self *comparer) add(path string, expected, actual interface{}, message string) {
+	self.diffs = append(self.diffs, Diff{Path: path, Expected: expected, Actual: actual, Message: message})
+}
+
+func (self *comparer) compare(path string, expected, actual interface{}) {
+	if matchAny(self.ignore, path) {
+		return
+	}
+	if matchAny(self.present, path) {
+		if actual == nil || actual == "" {
+			self.add(path, expected, actual, "value missing")
+		}
+		return
+	}
+	for _, rule := range self.regex {
+		if rule.path.MatchString(path) {
+			if str, ok := actual.(string); !ok || !rule.pattern.MatchString(str) {
+				self.add(path, rule.pattern.String(), actual, "value does not match")
+			}
+			return
+		}
+	}
+
+	switch exp := expected.(type) {
+	case map[string]interface{}:
+		act, ok := actual.(map[string]interface{})
+		if !ok {
+			self.add(path, expected, actual, "type changed")
+			return
+		}
+		keys := []string{}
+		for key := range exp {
+			keys = append(keys, key)
+		}
+		for key := range act {
+			if _, ok := exp[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			sub := path + "." + key
+			expVal, inExp := exp[key]
+			actVal, inAct := act[key]
+			if !inAct {
+				if !matchAny(self.ignore, sub) {
+					self.add(sub, expVal, nil, "field missing")
+				}
+			} else if !inExp {
+				if !matchAny(self.ignore, sub) {
+					self.add(sub, nil, actVal, "unexpected field")
+				}
+			} else {
+				self.compare(sub, expVal, actVal)
+			}
+		}
+	case []interface{}:
+		act, ok := actual.([]interface{})
+		if !ok {
+			self.add(path, expected, actual, "type changed")
+			return
+		}
+		if len(exp) != len(act) {
+			self.add(path, len(exp), len(act), "length changed")
+		}
+		for i := 0; i < len(exp) && i < len(act); i++ {
+			self.compare(path+"["+strconv.Itoa(i)+"]", exp[i], act[i])
+		}
+	default:
+		if !reflect.DeepEqual(expected, actual) {
+			self.add(path, expected, actual, "value changed")
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package golden
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"unicode/utf8"
+	"zhongguo/extractor"
+)
+
+func TestCheck(t *testing.T) {
+	Check(t, extractor.NewExtractor(), "testdata")
+}
+
+func TestCompare(t *testing.T) {
+	expected := map[string]interface{}{
+		"title": "a",
+		"items": []interface{}{
+			map[string]interface{}{"price": "1"},
+			map[string]interface{}{"price": "2"},
+		},
+	}
+	actual := map[string]interface{}{
+		"items": []interface{}{
+			map[string]interface{}{"price": "1"},
+			map[string]interface{}{"price": "3"},
+		},
+	}
+	diffs, _ := Compare(expected, actual, nil)
+	if len(diffs) != 2 || diffs[0].Path != "$.items[1].price" || diffs[1].Path != "$.title" {
+		t.Error(diffs)
+	}
+	diffs, _ = Compare(expected, actual, &Tolerance{Ignore: []string{"items[*].price", "title"}})
+	if len(diffs) != 0 {
+		t.Error(diffs)
+	}
+	t.Log(diffs)
+}
+
+func TestCompareRegexOrder(t *testing.T) {
+	tolerance := &Tolerance{}
+	if err := json.Unmarshal([]byte(`{"regex":{"items[0].price":"^1$","items[*].price":"^\\d+$"}}`), tolerance); err != nil {
+		t.Fatal(err)
+	}
+	if len(tolerance.Regex) != 2 || tolerance.Regex[0].Path != "items[0].price" {
+		t.Fatal(tolerance.Regex)
+	}
+	actual := map[string]interface{}{
+		"items": []interface{}{
+			map[string]interface{}{"price": "2"},
+			map[string]interface{}{"price": "3"},
+		},
+	}
+	expected := map[string]interface{}{
+		"items": []interface{}{
+			map[string]interface{}{"price": "1"},
+			map[string]interface{}{"price": "1"},
+		},
+	}
+	for i := 0; i < 20; i++ {
+		diffs, _ := Compare(expected, actual, tolerance)
+		if len(diffs) != 1 || diffs[0].Path != "$.items[0].price" {
+			t.Fatal(diffs)
+		}
+	}
+	data, _ := json.Marshal(tolerance.Regex)
+	if string(data) != `{"items[0].price":"^1$","items[*].price":"^\\d+$"}` {
+		t.Error(string(data))
+	}
+}
+
+func TestEncodeTruncate(t *testing.T) {
+	out := encode(strings.Repeat("中", 100))
+	if out != `"`+strings.Repeat("中", 79)+"..." || !utf8.ValidString(out) {
+		t.Error(out)
+	}
+}
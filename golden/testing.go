@@ -0,0 +1,32 @@
+package golden
+
+import (
+	"os"
+	"testing"
+	"zhongguo/extractor"
+)
+
+// UpdateEnv names the environment variable that makes Check rewrite the
+// goldens instead of comparing against them.
+const UpdateEnv = "EXTRACTOR_UPDATE_GOLDEN"
+
+// Check runs every fixture below root as a subtest of t.
+func Check(t *testing.T, ex *extractor.Extractor, root string) {
+	dirs, err := Find(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	update := len(os.Getenv(UpdateEnv)) > 0
+	for _, dir := range dirs {
+		dir := dir
+		t.Run(dir, func(t *testing.T) {
+			ret := Run(ex, dir, update)
+			if ret.Err != nil {
+				t.Fatal(ret.Err)
+			}
+			for _, diff := range ret.Diffs {
+				t.Error(diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package extractor
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const IMG_ATTR = "img"
+
+// imgPriority is the default order ;img looks for the real image url in,
+// lazy loading attributes first as src often holds a placeholder.
+var imgPriority = []string{"data-src", "data-original", "data-lazy", "data-srcset", "srcset", "src", "style"}
+
+var cssURLRegex = regexp.MustCompile(`url\(\s*['"]?([^'")]+?)['"]?\s*\)`)
+
+// imgPriorityOf returns the attribute order of an ;img or ;img(a,b) mode.
+func imgPriorityOf(attr string) []string {
+	if !strings.HasPrefix(attr, IMG_ATTR+"(") || !strings.HasSuffix(attr, ")") {
+		return imgPriority
+	}
+	ret := []string{}
+	for _, name := range strings.Split(attr[len(IMG_ATTR)+1:len(attr)-1], ",") {
+		if name = strings.TrimSpace(name); len(name) > 0 {
+			ret = append(ret, name)
+		}
+	}
+	return ret
+}
+
+func isImgAttr(attr string) bool {
+	return attr == IMG_ATTR || strings.HasPrefix(attr, IMG_ATTR+"(")
+}
+
+// imageURL returns the best image url of node following priority, or of
+// the first img inside it when node itself has none.
+func (self *Extractor) imageURL(priority []string, node *goquery.Selection) string {
+	if link := imageCandidate(priority, node); len(link) > 0 {
+		return self.absURL(link)
+	}
+	if img := node.Find("img").First(); img.Size() > 0 {
+		return self.absURL(imageCandidate(priority, img))
+	}
+	return ""
+}
+
+func imageCandidate(priority []string, node *goquery.Selection) string {
+	for _, name := range priority {
+		val, ok := node.Attr(name)
+		if !ok {
+			continue
+		}
+		switch {
+		case strings.HasSuffix(name, "srcset"):
+			val = largestSrcset(val)
+		case name == "style":
+			val = cssURL(val)
+		}
+		val = strings.TrimSpace(val)
+		if len(val) > 0 && !strings.HasPrefix(val, "data:") {
+			return val
+		}
+	}
+	return ""
+}
+
+// largestSrcset picks the candidate with the largest width, or density,
+// descriptor of a srcset such as "a.jpg 320w, b.jpg 800w". As in the html
+// spec a url runs to the next space, so commas inside it, common in cdn
+// urls like "/w_320,h_240/a.jpg", do not split it.
+func largestSrcset(srcset string) string {
+	best, bestSize := "", -1.0
+	isSpace := func(c byte) bool {
+		return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+	}
+	for i := 0; i < len(srcset); {
+		for i < len(srcset) && (isSpace(srcset[i]) || srcset[i] == ',') {
+			i++
+		}
+		start := i
+		for i < len(srcset) && !isSpace(srcset[i]) {
+			i++
+		}
+		url, descriptor := srcset[start:i], ""
+		if trimmed := strings.TrimRight(url, ","); len(trimmed) < len(url) {
+			// a url ending with a comma has no descriptor
+			url = trimmed
+		} else {
+			start = i
+			for i < len(srcset) && srcset[i] != ',' {
+				i++
+			}
+			descriptor = strings.TrimSpace(srcset[start:i])
+		}
+		if len(url) == 0 {
+			continue
+		}
+		size := 1.0
+		if fields := strings.Fields(descriptor); len(fields) > 0 {
+			if n, err := strconv.ParseFloat(fields[0][:len(fields[0])-1], 64); err == nil {
+				size = n
+			}
+		}
+		if size > bestSize {
+			best, bestSize = url, size
+		}
+	}
+	return best
+}
+
+// cssURL returns the first url() of a css declaration such as
+// background-image:url('a.jpg').
+func cssURL(style string) string {
+	m := cssURLRegex.FindStringSubmatch(style)
+	if m == nil {
+		return ""
+	}
+	return m[1]
+}
@@ -0,0 +1,54 @@
+package extractor
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestImageURL(t *testing.T) {
+	body := []byte(`<html><body>
+		<img id="lazy" src="data:image/gif;base64,R0lGODlhAQABAAAAACw=" data-original="/big/1.jpg">
+		<img id="srcset" src="/small.jpg" srcset="/s.jpg 320w, /l.jpg 1280w, /m.jpg 800w">
+		<div id="bg" style="background-image: url('//cdn.example.com/bg.png')"></div>
+		<a id="wrap" href="/item"><img src="/thumb.jpg"></a>
+		<img id="custom" src="/a.jpg" data-zoom="/zoom.jpg">
+		</body></html>`)
+	config := `{
+		"lazy":"#lazy;img",
+		"srcset":"#srcset;img",
+		"bg":"#bg;img",
+		"wrap":"#wrap;img",
+		"custom":"#custom;img(data-zoom,src)",
+		"all":"img@all;img",
+		"original":"#lazy;data-original"
+	}`
+	m := map[string]interface{}{}
+	json.Unmarshal([]byte(config), &m)
+	extractor := NewExtractor()
+	extractor.BaseURL = "https://shop.example.com/item/1"
+	ret := extractor.Do(m, body)
+	out, _ := json.Marshal(ret)
+	expected := `{"all":["https://shop.example.com/big/1.jpg","https://shop.example.com/l.jpg","https://shop.example.com/thumb.jpg","https://shop.example.com/a.jpg"],"bg":"https://cdn.example.com/bg.png","custom":"https://shop.example.com/zoom.jpg","lazy":"https://shop.example.com/big/1.jpg","original":"https://shop.example.com/big/1.jpg","srcset":"https://shop.example.com/l.jpg","wrap":"https://shop.example.com/thumb.jpg"}`
+	if string(out) != expected {
+		t.Error(string(out))
+	}
+	if cssURL(`background:url("x.png") no-repeat`) != "x.png" {
+		t.Error("css url")
+	}
+	for srcset, want := range map[string]string{
+		"a.jpg 1x, b.jpg 2x": "b.jpg",
+		"https://cdn.example.com/w_320,h_240/a.jpg 320w, https://cdn.example.com/w_1280,h_960/a.jpg 1280w": "https://cdn.example.com/w_1280,h_960/a.jpg",
+		"/c_fill,w_800/a.jpg":             "/c_fill,w_800/a.jpg",
+		"a.jpg 1x,b.jpg 2x":               "b.jpg",
+		"  a.jpg  320w ,\n b.jpg 640w  ":  "b.jpg",
+		"a.jpg 640w,/w_1,h_1/b.jpg 320w,": "a.jpg",
+	} {
+		if got := largestSrcset(srcset); got != want {
+			t.Errorf("%q: %q", srcset, got)
+		}
+	}
+	body = []byte(`<img srcset="https://cdn.example.com/w_320,h_240/a.jpg 320w, https://cdn.example.com/w_1280,h_960/a.jpg 1280w">`)
+	if ret := extractor.Do(map[string]interface{}{"img": "img;img"}, body); ret.(map[string]interface{})["img"] != "https://cdn.example.com/w_1280,h_960/a.jpg" {
+		t.Error(ret)
+	}
+}
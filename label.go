@@ -0,0 +1,199 @@
+package extractor
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+)
+
+var (
+	labelRegex  = regexp.MustCompile(`^(.*?)@label\(([^)]*)\)\s*(.*)$`)
+	inlinePair  = regexp.MustCompile(`^([^:：]{1,30}?)\s*[:：]\s*(.+)$`)
+	labelSuffix = ":： "
+)
+
+// ownText returns the text of the direct text children of s.
+func ownText(s *goquery.Selection) string {
+	text := ""
+	for c := s.Get(0).FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.TextNode {
+			text += c.Data
+		}
+	}
+	return normalizeSpace(text)
+}
+
+func trimLabel(s string) string {
+	return strings.TrimRight(s, labelSuffix)
+}
+
+// textAfter returns the text following s inside its parent up to the next
+// element, e.g. "张三" in <b>姓名:</b> 张三<br>.
+func textAfter(s *goquery.Selection) string {
+	text := ""
+	for n := s.Get(0).NextSibling; n != nil; n = n.NextSibling {
+		if n.Type == html.TextNode {
+			text += n.Data
+		} else if n.Type == html.ElementNode {
+			break
+		}
+	}
+	return normalizeSpace(text)
+}
+
+type labelValue struct {
+	sel  *goquery.Selection
+	text string
+}
+
+// valueOf applies the common label/value layouts to the label element l:
+// dt/dd, th/td by row or by column, td/td, label[for], "label: value" in one
+// text node, an adjacent element or the text right after the label.
+func valueOf(l *goquery.Selection, label string) *labelValue {
+	own := ownText(l)
+	if trimLabel(own) != label {
+		if group := inlinePair.FindStringSubmatch(own); group != nil && group[1] == label {
+			return &labelValue{sel: l, text: normalizeSpace(group[2])}
+		}
+		return nil
+	}
+	name := goquery.NodeName(l)
+	next := l.Next()
+	switch name {
+	case "dt":
+		if dd := l.NextFiltered("dd"); dd.Size() > 0 {
+			return &labelValue{sel: dd, text: normalizeSpace(dd.Text())}
+		}
+	case "th", "td":
+		if next.Size() > 0 && goquery.NodeName(next) == "td" {
+			return &labelValue{sel: next, text: normalizeSpace(next.Text())}
+		}
+		if name == "th" {
+			index := l.Index()
+			cell := l.Parent().Next().Children().Eq(index)
+			if cell.Size() > 0 {
+				return &labelValue{sel: cell, text: normalizeSpace(cell.Text())}
+			}
+		}
+	case "label":
+		if id, ok := l.Attr("for"); ok && len(id) > 0 {
+			input := l.Parents().Last().Find("[id='" + id + "']")
+			if input.Size() > 0 {
+				if v, ok := input.Attr("value"); ok {
+					return &labelValue{sel: input, text: normalizeSpace(v)}
+				}
+				return &labelValue{sel: input, text: normalizeSpace(input.Text())}
+			}
+		}
+	}
+	if text := textAfter(l); len(text) > 0 {
+		return &labelValue{sel: l.Parent(), text: text}
+	}
+	if next.Size() > 0 {
+		return &labelValue{sel: next, text: normalizeSpace(next.Text())}
+	}
+	return nil
+}
+
+func findLabel(s *goquery.Selection, label string) *labelValue {
+	var ret *labelValue
+	s.Find("*").EachWithBreak(func(i int, l *goquery.Selection) bool {
+		if v := valueOf(l, label); v != nil && len(v.text) > 0 {
+			ret = v
+			return false
+		}
+		return true
+	})
+	return ret
+}
+
+// extractLabel handles "[scope] @label(name) [selector]": it locates the
+// element labelled name and returns its value, or applies selector to the
+// value element.
+func (self *Extractor) extractLabel(v string, s *goquery.Selection) interface{} {
+	group := labelRegex.FindStringSubmatch(v)
+	if group == nil {
+		return nil
+	}
+	scope := s
+	if css := strings.TrimSpace(group[1]); len(css) > 0 {
+		scope = queryXpath(css, s)
+		if scope == nil {
+			return nil
+		}
+	}
+	value := findLabel(scope, group[2])
+	if value == nil {
+		self.traceSelector(v, 0)
+		return nil
+	}
+	self.traceSelector(v, 1)
+	self.traceHtml(value.sel)
+	if rest := group[3]; len(rest) > 0 {
+		// the selector may name the value element itself, as in
+		// @label(详情) a;href for <span>详情</span><a href>
+		if xpath := self.htmlSelector(rest).Xpath; len(xpath) > 0 && value.sel.Is(xpath) {
+			rest = strings.TrimPrefix(rest, xpath)
+		}
+		return self.extractSingle(rest, value.sel)
+	}
+	self.traceRaw(value.text)
+	return value.text
+}
+
+// extractPairs turns a label/value section into a map of label to value.
+func (self *Extractor) extractPairs(s *goquery.Selection) map[string]interface{} {
+	ret := make(map[string]interface{})
+	add := func(label, value string) {
+		label = trimLabel(normalizeSpace(label))
+		if len(label) == 0 {
+			return
+		}
+		if _, ok := ret[label]; !ok {
+			ret[label] = nilIfEmpty(normalizeSpace(value))
+		}
+	}
+
+	s.Find("dt").Each(func(i int, dt *goquery.Selection) {
+		if dd := dt.NextFiltered("dd"); dd.Size() > 0 {
+			add(dt.Text(), dd.Text())
+		}
+	})
+	s.Find("tr").Each(func(i int, tr *goquery.Selection) {
+		cells := tr.Children().Filter("th,td")
+		if cells.Filter("th").Size() > 0 {
+			cells.Filter("th").Each(func(i int, th *goquery.Selection) {
+				if td := th.Next(); td.Size() > 0 && goquery.NodeName(td) == "td" {
+					add(th.Text(), td.Text())
+				}
+			})
+		} else if cells.Size()%2 == 0 {
+			for c := 0; c < cells.Size(); c += 2 {
+				add(cells.Eq(c).Text(), cells.Eq(c+1).Text())
+			}
+		}
+	})
+	s.AddSelection(s.Find("*")).Each(func(i int, e *goquery.Selection) {
+		switch goquery.NodeName(e) {
+		case "dt", "dd", "tr", "th", "td", "table", "tbody", "thead":
+			return
+		}
+		own := ownText(e)
+		if e.Children().Size() == 0 {
+			if group := inlinePair.FindStringSubmatch(own); group != nil {
+				add(group[1], group[2])
+				return
+			}
+		}
+		if strings.ContainsAny(own, ":：") && trimLabel(own) != own && !strings.ContainsAny(trimLabel(own), ":：") {
+			if text := textAfter(e); len(text) > 0 {
+				add(own, text)
+			} else if next := e.Next(); next.Size() > 0 {
+				add(own, next.Text())
+			}
+		}
+	})
+	return ret
+}
@@ -0,0 +1,50 @@
+package extractor
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+var labelPage = []byte(`<html><body>
+	<div class="info">
+		<p>真实姓名：张三</p>
+		<dl><dt>手机号</dt><dd>138****0000</dd></dl>
+		<table><tr><th>身份证</th><td>1101**********</td></tr></table>
+		<div><b>学历:</b> 本科<br><span class="k">城市</span><span>北京</span></div>
+		<p><span>借款</span><a href="/loan/1">详情</a></p>
+	</div>
+	</body></html>`)
+
+func TestLabel(t *testing.T) {
+	config := `{
+		"name":"@label(真实姓名)",
+		"phone":"@label(手机号)",
+		"id":"div.info @label(身份证)",
+		"degree":"@label(学历)",
+		"city":"@label(城市)",
+		"loan":"@label(借款) a;href"
+	}`
+	m := map[string]interface{}{}
+	json.Unmarshal([]byte(config), &m)
+	ret := NewExtractor().Do(m, labelPage).(map[string]interface{})
+	expected := map[string]string{
+		"name": "张三", "phone": "138****0000", "id": "1101**********",
+		"degree": "本科", "city": "北京", "loan": "/loan/1",
+	}
+	for key, val := range expected {
+		if ret[key] != val {
+			t.Error(key, ret[key])
+		}
+	}
+}
+
+func TestPairs(t *testing.T) {
+	config := `{"_root":"div.info", "_pairs":true}`
+	m := map[string]interface{}{}
+	json.Unmarshal([]byte(config), &m)
+	ret := NewExtractor().Do(m, labelPage).(map[string]interface{})
+	if ret["真实姓名"] != "张三" || ret["手机号"] != "138****0000" || ret["身份证"] != "1101**********" || ret["学历"] != "本科" {
+		t.Error(ret)
+	}
+	t.Log(ret)
+}
@@ -0,0 +1,263 @@
+package extractor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xlvector/dlog"
+	"gopkg.in/yaml.v3"
+)
+
+type ConfigStatus struct {
+	Name     string    `json:"name"`
+	Path     string    `json:"path"`
+	ModTime  time.Time `json:"mod_time"`
+	LoadedAt time.Time `json:"loaded_at"`
+	Error    string    `json:"error,omitempty"`
+}
+
+type libraryEntry struct {
+	config   interface{}
+	status   ConfigStatus
+	collided bool
+}
+
+// ConfigLibrary holds the named configs found in a directory. The name of a
+// config is its path relative to the directory without extension, with
+// path separators replaced by dots, e.g. taobao/item.v3.json is taobao.item.v3.
+type ConfigLibrary struct {
+	Dir     string
+	lock    sync.RWMutex
+	entries map[string]*libraryEntry
+	stop    chan struct{}
+}
+
+func NewConfigLibrary(dir string) *ConfigLibrary {
+	return &ConfigLibrary{
+		Dir:     dir,
+		entries: make(map[string]*libraryEntry),
+	}
+}
+
+func configName(dir, path string) string {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		rel = filepath.Base(path)
+	}
+	rel = strings.TrimSuffix(rel, filepath.Ext(rel))
+	return strings.Replace(filepath.ToSlash(rel), "/", ".", -1)
+}
+
+func isConfigFile(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json", ".yaml", ".yml":
+		return true
+	}
+	return false
+}
+
+func LoadConfigFile(path string) (interface{}, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var config interface{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		var raw interface{}
+		if err := yaml.Unmarshal(data, &raw); err != nil {
+			return nil, err
+		}
+		// round trip through json so that yaml configs carry the same value
+		// types as json ones
+		if data, err = json.Marshal(raw); err != nil {
+			return nil, err
+		}
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, err
+	}
+	switch config.(type) {
+	case map[string]interface{}, []interface{}:
+		return config, nil
+	}
+	return nil, errors.New("config must be an object or an array")
+}
+
+type configFile struct {
+	path    string
+	modTime time.Time
+}
+
+// Load scans the directory and (re)loads every config file that is new or
+// has changed since the last load. A config that fails to load, or whose
+// name is shared by several files such as a.json and a.yaml, keeps its
+// previous good version; the failure is reported by Status.
+func (self *ConfigLibrary) Load() error {
+	files := make(map[string][]configFile)
+	err := filepath.Walk(self.Dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !isConfigFile(path) {
+			return nil
+		}
+		name := configName(self.Dir, path)
+		files[name] = append(files[name], configFile{path: path, modTime: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for name, found := range files {
+		if len(found) > 1 {
+			paths := []string{}
+			for _, file := range found {
+				paths = append(paths, file.path)
+			}
+			self.fail(name, found[0], fmt.Errorf("config name %s is used by %s", name, strings.Join(paths, ", ")), true)
+			continue
+		}
+		file := found[0]
+		self.lock.RLock()
+		entry, ok := self.entries[name]
+		self.lock.RUnlock()
+		if ok && entry.status.Path == file.path && entry.status.ModTime.Equal(file.modTime) && !entry.collided {
+			continue
+		}
+		config, loadErr := LoadConfigFile(file.path)
+		if loadErr != nil {
+			self.fail(name, file, loadErr, false)
+			continue
+		}
+		self.lock.Lock()
+		self.entries[name] = &libraryEntry{
+			config: config,
+			status: ConfigStatus{
+				Name:     name,
+				Path:     file.path,
+				ModTime:  file.modTime,
+				LoadedAt: time.Now(),
+			},
+		}
+		self.lock.Unlock()
+	}
+
+	self.lock.Lock()
+	for name := range self.entries {
+		if _, ok := files[name]; !ok {
+			delete(self.entries, name)
+		}
+	}
+	self.lock.Unlock()
+	return nil
+}
+
+// fail records why name could not be loaded, keeping its previous config.
+func (self *ConfigLibrary) fail(name string, file configFile, err error, collided bool) {
+	dlog.Warn("load config %s error %v", file.path, err)
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	entry, ok := self.entries[name]
+	if !ok {
+		entry = &libraryEntry{}
+		self.entries[name] = entry
+	}
+	entry.status.Name = name
+	entry.status.Path = file.path
+	entry.status.ModTime = file.modTime
+	entry.status.Error = err.Error()
+	entry.collided = collided
+}
+
+func (self *ConfigLibrary) Get(name string) (interface{}, bool) {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+	entry, ok := self.entries[name]
+	if !ok || entry.config == nil {
+		return nil, false
+	}
+	return entry.config, true
+}
+
+func (self *ConfigLibrary) Names() []string {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+	names := []string{}
+	for name, entry := range self.entries {
+		if entry.config != nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (self *ConfigLibrary) Status() []ConfigStatus {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+	ret := []ConfigStatus{}
+	for _, entry := range self.entries {
+		ret = append(ret, entry.status)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Name < ret[j].Name
+	})
+	return ret
+}
+
+// Watch reloads the library every interval until Close is called.
+func (self *ConfigLibrary) Watch(interval time.Duration) {
+	self.lock.Lock()
+	if self.stop != nil {
+		self.lock.Unlock()
+		return
+	}
+	stop := make(chan struct{})
+	self.stop = stop
+	self.lock.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if err := self.Load(); err != nil {
+					dlog.Warn("reload %s error %v", self.Dir, err)
+				}
+			}
+		}
+	}()
+}
+
+func (self *ConfigLibrary) Close() {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if self.stop != nil {
+		close(self.stop)
+		self.stop = nil
+	}
+}
+
+func (self *Extractor) namedConfig(name string) (interface{}, error) {
+	if self.Library == nil {
+		return nil, errors.New("no config library")
+	}
+	config, ok := self.Library.Get(name)
+	if !ok {
+		return nil, fmt.Errorf("config %s not found", name)
+	}
+	return config, nil
+}
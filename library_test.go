@@ -0,0 +1,58 @@
+package extractor
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfigLibrary(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "library")
+	defer os.RemoveAll(dir)
+	os.MkdirAll(filepath.Join(dir, "taobao"), 0755)
+	item := filepath.Join(dir, "taobao", "item.v3.json")
+	ioutil.WriteFile(item, []byte(`{"title":"h1"}`), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "list.yaml"), []byte("_root: li@array\nname: a\n"), 0644)
+
+	library := NewConfigLibrary(dir)
+	library.Load()
+	if names := library.Names(); len(names) != 2 || names[0] != "list" || names[1] != "taobao.item.v3" {
+		t.Error(names)
+	}
+
+	ioutil.WriteFile(item, []byte(`{"title":`), 0644)
+	os.Chtimes(item, time.Now(), time.Now().Add(time.Second))
+	library.Load()
+	config, ok := library.Get("taobao.item.v3")
+	if !ok || config.(map[string]interface{})["title"] != "h1" {
+		t.Error("previous good version lost", config)
+	}
+	for _, status := range library.Status() {
+		if status.Name == "taobao.item.v3" && len(status.Error) == 0 {
+			t.Error("reload failure not reported")
+		}
+	}
+	t.Log(library.Status())
+
+	ioutil.WriteFile(filepath.Join(dir, "list.json"), []byte(`{"name":"b"}`), 0644)
+	for i := 0; i < 3; i++ {
+		library.Load()
+		config, ok := library.Get("list")
+		if !ok || config.(map[string]interface{})["name"] != "a" {
+			t.Error("colliding config replaced the previous version", config)
+		}
+	}
+	for _, status := range library.Status() {
+		if status.Name == "list" && !strings.Contains(status.Error, "list.json") {
+			t.Error("collision not reported", status)
+		}
+	}
+	os.Remove(filepath.Join(dir, "list.yaml"))
+	library.Load()
+	if config, _ := library.Get("list"); config.(map[string]interface{})["name"] != "b" {
+		t.Error("config not loaded once the collision is gone", config)
+	}
+}
@@ -0,0 +1,199 @@
+package extractor
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/xlvector/dlog"
+)
+
+var jsonldRegex = regexp.MustCompile(`^@jsonld(?:\(([^)]*)\))?\.?(.*)$`)
+
+// Metadata collects the structured data embedded in an html page:
+//
+//	{
+//	    "jsonld":    [...],  // every JSON-LD object, @graph flattened
+//	    "microdata": [...],  // itemscope trees as {"@type": ..., prop: value}
+//	    "rdfa":      [...],  // RDFa Lite typeof trees, same shape
+//	    "opengraph": {...},  // og:* meta tags without the og: prefix
+//	    "twitter":   {...},  // twitter:* meta tags without the prefix
+//	    "meta":      {...}   // other named meta tags
+//	}
+func Metadata(s *goquery.Selection) map[string]interface{} {
+	return map[string]interface{}{
+		"jsonld":    jsonLD(s),
+		"microdata": itemScopes(s, "itemscope", "itemtype", "itemprop"),
+		"rdfa":      itemScopes(s, "typeof", "typeof", "property"),
+		"opengraph": metaTags(s, "og:"),
+		"twitter":   metaTags(s, "twitter:"),
+		"meta":      metaTags(s, ""),
+	}
+}
+
+func jsonLD(s *goquery.Selection) []interface{} {
+	ret := []interface{}{}
+	var flatten func(v interface{})
+	flatten = func(v interface{}) {
+		switch val := v.(type) {
+		case []interface{}:
+			for _, sub := range val {
+				flatten(sub)
+			}
+		case map[string]interface{}:
+			if graph, ok := val["@graph"]; ok {
+				flatten(graph)
+				return
+			}
+			ret = append(ret, val)
+		}
+	}
+	s.Find(`script[type="application/ld+json"]`).Each(func(i int, script *goquery.Selection) {
+		var v interface{}
+		text := strings.TrimSpace(script.Text())
+		if err := json.Unmarshal([]byte(text), &v); err != nil {
+			dlog.Warn("json-ld %s", err.Error())
+			return
+		}
+		flatten(v)
+	})
+	return ret
+}
+
+func shortType(t string) string {
+	t = strings.TrimSpace(t)
+	if p := strings.LastIndexAny(t, "/#"); p >= 0 {
+		return t[p+1:]
+	}
+	return t
+}
+
+func itemValue(e *goquery.Selection) string {
+	for _, attr := range []string{"content", "href", "src", "datetime", "value"} {
+		if v, ok := e.Attr(attr); ok {
+			return strings.TrimSpace(v)
+		}
+	}
+	return normalizeSpace(e.Text())
+}
+
+func addProp(item map[string]interface{}, name string, v interface{}) {
+	if old, ok := item[name]; ok {
+		if arr, ok := old.([]interface{}); ok {
+			item[name] = append(arr, v)
+		} else {
+			item[name] = []interface{}{old, v}
+		}
+		return
+	}
+	item[name] = v
+}
+
+// itemScopes reads microdata (itemscope/itemtype/itemprop) or RDFa Lite
+// (typeof/property) trees. Nested scopes become nested objects.
+func itemScopes(s *goquery.Selection, scopeAttr, typeAttr, propAttr string) []interface{} {
+	var parse func(scope *goquery.Selection) map[string]interface{}
+	parse = func(scope *goquery.Selection) map[string]interface{} {
+		item := map[string]interface{}{}
+		if t, ok := scope.Attr(typeAttr); ok && len(t) > 0 {
+			item["@type"] = shortType(t)
+		}
+		scope.Find("[" + propAttr + "]").Each(func(i int, e *goquery.Selection) {
+			// skip properties belonging to a nested scope
+			if owner := e.Parent().Closest("[" + scopeAttr + "]"); owner.Size() > 0 && owner.Get(0) != scope.Get(0) {
+				return
+			}
+			var v interface{}
+			if _, ok := e.Attr(scopeAttr); ok {
+				v = parse(e)
+			} else {
+				v = itemValue(e)
+			}
+			for _, name := range strings.Fields(e.AttrOr(propAttr, "")) {
+				addProp(item, shortType(name), v)
+			}
+		})
+		return item
+	}
+	ret := []interface{}{}
+	s.Find("[" + scopeAttr + "]").Each(func(i int, scope *goquery.Selection) {
+		if _, ok := scope.Attr(propAttr); ok && scope.Parent().Closest("["+scopeAttr+"]").Size() > 0 {
+			return
+		}
+		ret = append(ret, parse(scope))
+	})
+	return ret
+}
+
+func metaTags(s *goquery.Selection, prefix string) map[string]interface{} {
+	ret := map[string]interface{}{}
+	s.Find("meta[content]").Each(func(i int, meta *goquery.Selection) {
+		name := meta.AttrOr("property", "")
+		if len(name) == 0 {
+			name = meta.AttrOr("name", "")
+		}
+		if len(name) == 0 {
+			return
+		}
+		if len(prefix) == 0 {
+			if strings.HasPrefix(name, "og:") || strings.HasPrefix(name, "twitter:") {
+				return
+			}
+		} else if !strings.HasPrefix(name, prefix) {
+			return
+		} else {
+			name = strings.TrimPrefix(name, prefix)
+		}
+		addProp(ret, name, meta.AttrOr("content", ""))
+	})
+	return ret
+}
+
+func jsonldType(item map[string]interface{}) []string {
+	switch t := item["@type"].(type) {
+	case string:
+		return []string{shortType(t)}
+	case []interface{}:
+		ret := []string{}
+		for _, sub := range t {
+			if str, ok := sub.(string); ok {
+				ret = append(ret, shortType(str))
+			}
+		}
+		return ret
+	}
+	return nil
+}
+
+// extractJsonLD handles "@jsonld(Type).path": the first JSON-LD object of
+// the given type (any object without a type) queried with a json path.
+func (self *Extractor) extractJsonLD(v string, s *goquery.Selection) interface{} {
+	group := jsonldRegex.FindStringSubmatch(v)
+	if group == nil {
+		return nil
+	}
+	root := s
+	if s.Parents().Size() > 0 {
+		root = s.Parents().Last()
+	}
+	for _, item := range jsonLD(root) {
+		m := item.(map[string]interface{})
+		if len(group[1]) > 0 {
+			found := false
+			for _, t := range jsonldType(m) {
+				found = found || t == group[1]
+			}
+			if !found {
+				continue
+			}
+		}
+		if len(group[2]) == 0 {
+			self.traceSelector(v, 1)
+			return m
+		}
+		return self.ExtractJsonSingle(group[2], NewSimplejson(m))
+	}
+	self.traceSelector(v, 0)
+	return nil
+}
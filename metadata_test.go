@@ -0,0 +1,61 @@
+package extractor
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+var metadataPage = []byte(`<html><head>
+	<meta property="og:title" content="Phone X">
+	<meta property="og:image" content="https://img.example.com/x.jpg">
+	<meta name="twitter:card" content="summary">
+	<meta name="description" content="a phone">
+	<script type="application/ld+json">
+	{"@context":"https://schema.org","@graph":[
+		{"@type":"BreadcrumbList","itemListElement":[]},
+		{"@type":"Product","name":"Phone X","offers":{"@type":"Offer","price":"199.00","priceCurrency":"CNY"}}
+	]}
+	</script>
+	</head><body>
+	<div itemscope itemtype="https://schema.org/Product">
+		<span itemprop="name">Phone X</span>
+		<div itemprop="offers" itemscope itemtype="https://schema.org/Offer">
+			<meta itemprop="price" content="199.00"><span itemprop="priceCurrency">CNY</span>
+		</div>
+	</div>
+	<div vocab="https://schema.org/" typeof="Person"><span property="name">Zhang San</span></div>
+	</body></html>`)
+
+func TestMetadata(t *testing.T) {
+	config := `{
+		"_type":"metadata",
+		"title":"opengraph.title",
+		"card":"twitter.card",
+		"description":"meta.description",
+		"price":"jsonld.[1].offers.price",
+		"microprice":"microdata.[0].offers.price",
+		"person":"rdfa.[0].name"
+	}`
+	m := map[string]interface{}{}
+	json.Unmarshal([]byte(config), &m)
+	ret := NewExtractor().Do(m, metadataPage).(map[string]interface{})
+	expected := map[string]string{
+		"title": "Phone X", "card": "summary", "description": "a phone",
+		"price": "199.00", "microprice": "199.00", "person": "Zhang San",
+	}
+	for key, val := range expected {
+		if ret[key] != val {
+			t.Error(key, ret[key])
+		}
+	}
+}
+
+func TestJsonLDSelector(t *testing.T) {
+	config := `{"price":"@jsonld(Product).offers.price", "name":"@jsonld(Product).name"}`
+	m := map[string]interface{}{}
+	json.Unmarshal([]byte(config), &m)
+	ret := NewExtractor().Do(m, metadataPage).(map[string]interface{})
+	if ret["price"] != "199.00" || ret["name"] != "Phone X" {
+		t.Error(ret)
+	}
+}
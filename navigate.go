@@ -0,0 +1,315 @@
+package extractor
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// navStep is one modifier of a selector's navigation chain, such as
+// @closest(tr) or the legacy @index=2.
+type navStep struct {
+	Name   string
+	Arg    string
+	HasArg bool
+	Legacy bool
+}
+
+func (n navStep) String() string {
+	if n.Name == "find" {
+		return n.Arg
+	}
+	if n.Legacy {
+		return "@" + n.Name + "=" + n.Arg
+	}
+	if n.HasArg {
+		return "@" + n.Name + "(" + n.Arg + ")"
+	}
+	return "@" + n.Name
+}
+
+// navModifiers lists the known modifiers and whether they take an argument:
+// 1 means required, 0 optional and -1 none.
+var navModifiers = map[string]int{
+	"next":     0,
+	"prev":     0,
+	"parent":   0,
+	"closest":  1,
+	"children": 0,
+	"find":     1,
+	"filter":   1,
+	"eq":       1,
+	"index":    1,
+	"slice":    1,
+	"has":      1,
+	"not":      1,
+	"contains": 1,
+	"matches":  1,
+	"first":    -1,
+	"last":     -1,
+}
+
+// parseXpath splits a selector into its css part and the chain of navigation
+// modifiers that follow it, e.g. "span.label @next @closest(tr) @children(td)".
+// Css text written after a modifier becomes a find step, so "li @eq(0) a"
+// reads the links of the first item only.
+func parseXpath(xpath string) (string, []navStep, error) {
+	base := ""
+	steps := []navStep{}
+	var css strings.Builder
+	seenModifier := false
+	flush := func() {
+		text := strings.TrimSpace(css.String())
+		css.Reset()
+		if !seenModifier {
+			base = text
+		} else if len(text) > 0 {
+			steps = append(steps, navStep{Name: "find", Arg: text, HasArg: true})
+		}
+	}
+	depth := 0
+	var quote byte
+	for i := 0; i < len(xpath); i++ {
+		c := xpath[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && i+1 < len(xpath) {
+				css.WriteByte(c)
+				i++
+				c = xpath[i]
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '[' || c == '(':
+			depth++
+		case c == ']' || c == ')':
+			depth--
+		case c == '@' && depth == 0:
+			step, next, err := parseNavStep(xpath, i)
+			if err != nil {
+				return "", nil, err
+			}
+			flush()
+			seenModifier = true
+			steps = append(steps, step)
+			i = next - 1
+			continue
+		}
+		css.WriteByte(c)
+	}
+	if quote != 0 {
+		return "", nil, fmt.Errorf("%w: unterminated quote in selector %q", ErrInvalidConfig, xpath)
+	}
+	flush()
+	return base, steps, nil
+}
+
+// parseNavStep reads the modifier starting at xpath[start] == '@' and
+// returns it with the offset right after it.
+func parseNavStep(xpath string, start int) (navStep, int, error) {
+	i := start + 1
+	for i < len(xpath) && (xpath[i] >= 'a' && xpath[i] <= 'z' || xpath[i] >= 'A' && xpath[i] <= 'Z') {
+		i++
+	}
+	step := navStep{Name: strings.ToLower(xpath[start+1 : i])}
+	arity, ok := navModifiers[step.Name]
+	if !ok {
+		return step, i, fmt.Errorf("%w: unknown selector modifier %q at offset %d of %q", ErrInvalidConfig, xpath[start:i], start, xpath)
+	}
+	j := i
+	for j < len(xpath) && xpath[j] == ' ' {
+		j++
+	}
+	if j < len(xpath) && xpath[j] == '=' && (step.Name == "index" || step.Name == "parent") {
+		j++
+		for j < len(xpath) && xpath[j] == ' ' {
+			j++
+		}
+		end := j
+		for end < len(xpath) && xpath[end] != ' ' && xpath[end] != '@' {
+			end++
+		}
+		step.Arg, step.HasArg, step.Legacy = xpath[j:end], true, true
+		return step, end, nil
+	}
+	if i < len(xpath) && xpath[i] == '(' {
+		depth := 0
+		var quote byte
+		for j = i; j < len(xpath); j++ {
+			c := xpath[j]
+			if quote != 0 {
+				if c == '\\' {
+					j++
+				} else if c == quote {
+					quote = 0
+				}
+				continue
+			}
+			if c == '\'' || c == '"' {
+				quote = c
+			} else if c == '(' {
+				depth++
+			} else if c == ')' {
+				depth--
+				if depth == 0 {
+					break
+				}
+			}
+		}
+		if j >= len(xpath) {
+			return step, j, fmt.Errorf("%w: unclosed ( after @%s in %q", ErrInvalidConfig, step.Name, xpath)
+		}
+		if arity < 0 {
+			return step, j, fmt.Errorf("%w: @%s takes no argument in %q", ErrInvalidConfig, step.Name, xpath)
+		}
+		step.Arg, step.HasArg = strings.TrimSpace(xpath[i+1:j]), true
+		return step, j + 1, nil
+	}
+	if arity > 0 {
+		return step, i, fmt.Errorf("%w: @%s needs an argument in %q", ErrInvalidConfig, step.Name, xpath)
+	}
+	return step, i, nil
+}
+
+func unquote(arg string) string {
+	if len(arg) >= 2 && (arg[0] == '\'' || arg[0] == '"') && arg[len(arg)-1] == arg[0] {
+		return strings.Replace(arg[1:len(arg)-1], `\`+arg[:1], arg[:1], -1)
+	}
+	return arg
+}
+
+func navInt(step navStep, arg string) (int, error) {
+	n, err := strconv.Atoi(strings.TrimSpace(arg))
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s wants an integer, got %q", ErrInvalidConfig, step, arg)
+	}
+	return n, nil
+}
+
+// apply applies one navigation step to b.
+func (n navStep) apply(b *goquery.Selection) (*goquery.Selection, error) {
+	arg := unquote(n.Arg)
+	switch n.Name {
+	case "next":
+		if n.HasArg {
+			return b.NextFiltered(arg), nil
+		}
+		return b.Next(), nil
+	case "prev":
+		if n.HasArg {
+			return b.PrevFiltered(arg), nil
+		}
+		return b.Prev(), nil
+	case "parent":
+		if !n.HasArg {
+			return b.Parent(), nil
+		}
+		count, err := navInt(n, arg)
+		if err != nil {
+			return nil, err
+		}
+		if n.Legacy && b.Size() > 1 {
+			b = b.First()
+		}
+		for x := 0; x < count; x++ {
+			b = b.Parent()
+		}
+		return b, nil
+	case "closest":
+		return b.Closest(arg), nil
+	case "children":
+		if n.HasArg {
+			return b.ChildrenFiltered(arg), nil
+		}
+		return b.Children(), nil
+	case "find":
+		return b.Find(arg), nil
+	case "filter":
+		return b.Filter(arg), nil
+	case "eq", "index":
+		index, err := navInt(n, arg)
+		if err != nil {
+			return nil, err
+		}
+		return b.Eq(index), nil
+	case "slice":
+		bounds := strings.SplitN(arg, ",", 2)
+		start, err := navInt(n, bounds[0])
+		if err != nil {
+			return nil, err
+		}
+		end := b.Size()
+		if len(bounds) > 1 && len(strings.TrimSpace(bounds[1])) > 0 {
+			if end, err = navInt(n, bounds[1]); err != nil {
+				return nil, err
+			}
+		}
+		return sliceSelection(b, start, end), nil
+	case "has":
+		return b.Has(arg), nil
+	case "not":
+		return b.Not(arg), nil
+	case "contains":
+		return b.FilterFunction(func(i int, s *goquery.Selection) bool {
+			return strings.Contains(s.Text(), arg)
+		}), nil
+	case "matches":
+		reg, err := regexp.Compile(arg)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrInvalidConfig, n, err)
+		}
+		return b.FilterFunction(func(i int, s *goquery.Selection) bool {
+			return reg.MatchString(strings.TrimSpace(s.Text()))
+		}), nil
+	case "first":
+		return b.First(), nil
+	case "last":
+		return b.Last(), nil
+	}
+	return nil, fmt.Errorf("%w: unknown selector modifier @%s", ErrInvalidConfig, n.Name)
+}
+
+// sliceSelection is b[start:end] where negative bounds count from the end.
+func sliceSelection(b *goquery.Selection, start, end int) *goquery.Selection {
+	size := b.Size()
+	if start < 0 {
+		start += size
+	}
+	if end < 0 {
+		end += size
+	}
+	if start < 0 {
+		start = 0
+	}
+	if end > size {
+		end = size
+	}
+	if start >= end {
+		return b.Slice(0, 0)
+	}
+	return b.Slice(start, end)
+}
+
+// navigate evaluates a selector with its navigation chain against s, left
+// to right. An empty css part starts the chain from s itself.
+func navigate(xpath string, s *goquery.Selection) (*goquery.Selection, error) {
+	base, steps, err := parseXpath(xpath)
+	if err != nil {
+		return nil, err
+	}
+	b := s
+	if len(base) > 0 {
+		b = s.Find(base)
+	}
+	for _, step := range steps {
+		if b, err = step.apply(b); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
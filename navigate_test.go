@@ -0,0 +1,80 @@
+package extractor
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+var navigatePage = []byte(`<html><body><table class="loan">
+	<tr><td><span class="label">金额</span></td><td>1,000</td><td>元</td><td>已还</td></tr>
+	<tr><td><span class="label">期限</span></td><td>12</td><td>月</td><td>逾期</td></tr>
+	<tr class="foot"><td>合计 (2)</td><td>1,012</td><td></td><td></td></tr>
+	</table>
+	<ul><li>a</li><li class="hot">b</li><li>c</li><li>d</li></ul></body></html>`)
+
+func TestNavigate(t *testing.T) {
+	config := `{
+		"term":"span.label:contains('期限') @closest(tr) @children(td) @eq(-2)",
+		"next":"span.label @first @parent @next",
+		"legacy":"ul li @index=2",
+		"legacyParent":"span.label @parent=2 td@last",
+		"slice":"ul li @slice(1,-1)@all",
+		"tail":"ul li @slice(-2)@all",
+		"has":"tr @has(span.label) @last td@eq(1)",
+		"not":"ul li @not(.hot) @all",
+		"contains":"table tr @contains('(2)') td @first",
+		"matches":"td @matches(^\\d+$)",
+		"prev":"li.hot @prev",
+		"nextFiltered":"ul li @next(.hot)"
+	}`
+	m := map[string]interface{}{}
+	json.Unmarshal([]byte(config), &m)
+	ret := NewExtractor().Do(m, navigatePage)
+	out, _ := json.Marshal(ret)
+	expected := `{"contains":"合计 (2)","has":"12","legacy":"c","legacyParent":"已还","matches":"12","next":"1,000","nextFiltered":"b","not":["a","c","d"],"prev":"a","slice":["b","c"],"tail":["c","d"],"term":"月"}`
+	if string(out) != expected {
+		t.Error(string(out))
+	}
+}
+
+func TestParseXpathErrors(t *testing.T) {
+	doc, _ := goquery.NewDocumentFromReader(bytes.NewReader(navigatePage))
+	for _, xpath := range []string{"li @nope", "li @closest", "li @first(1)", "li @eq(x) a", "li @has(a"} {
+		b, err := navigate(xpath, doc.Selection)
+		if err == nil || !errors.Is(err, ErrInvalidConfig) || b != nil {
+			t.Errorf("%s: %v", xpath, err)
+		}
+	}
+	base, steps, err := parseXpath("a[href*='@x'] @last")
+	if err != nil || base != "a[href*='@x']" || len(steps) != 1 || steps[0].Name != "last" {
+		t.Error(base, steps, err)
+	}
+}
+
+func TestParseUnknownModifier(t *testing.T) {
+	for _, config := range []string{
+		`{"a":"h1 @nxt"}`,
+		`{"_root":"ul li @frist@array", "a":"a"}`,
+		`{"item":{"_root":"table tr", "a":"td @closest;href"}}`,
+		`{"_root":"table", "_table":true, "a":"@col(金额) span @nope"}`,
+		`{"@keyspan @nope":"td"}`,
+	} {
+		m := map[string]interface{}{}
+		json.Unmarshal([]byte(config), &m)
+		ret, err := NewExtractor().Parse(m, navigatePage)
+		if !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("%s: %v %v", config, ret, err)
+		}
+	}
+	// json paths and the special forms are not modifier chains
+	config := `{"a":"@data", "b":"@label(金额)", "c":"@col(x) span", "d":{"_type":"json", "e":"x.@y"}}`
+	m := map[string]interface{}{}
+	json.Unmarshal([]byte(config), &m)
+	if _, err := NewExtractor().Parse(m, navigatePage); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,152 @@
+package extractor
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type refResolver struct {
+	library *ConfigLibrary
+	stack   []string
+}
+
+// ResolveRefs returns a copy of config in which every {"$ref": ...} object is
+// replaced by the fragment it references. "#/_defs/seller" points into the
+// config itself, "taobao.common#/_defs/seller" into a config of the library
+// and "taobao.common" at a whole library config. Keys next to $ref override
+// the keys of the referenced fragment.
+func (self *Extractor) ResolveRefs(config interface{}) (interface{}, error) {
+	resolver := &refResolver{library: self.Library}
+	return resolver.resolve(config, "", config)
+}
+
+func (self *refResolver) resolve(node interface{}, doc string, root interface{}) (interface{}, error) {
+	switch val := node.(type) {
+	case map[string]interface{}:
+		if ref, ok := val[REF_DEFINE]; ok {
+			return self.resolveRef(val, ref, doc, root)
+		}
+		ret := make(map[string]interface{}, len(val))
+		for key, sub := range val {
+			if key == DEFS_DEFINE {
+				ret[key] = sub
+				continue
+			}
+			resolved, err := self.resolve(sub, doc, root)
+			if err != nil {
+				return nil, err
+			}
+			ret[key] = resolved
+		}
+		return ret, nil
+	case []interface{}:
+		ret := make([]interface{}, 0, len(val))
+		for _, sub := range val {
+			resolved, err := self.resolve(sub, doc, root)
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, resolved)
+		}
+		return ret, nil
+	}
+	return node, nil
+}
+
+func (self *refResolver) resolveRef(m map[string]interface{}, ref interface{}, doc string, root interface{}) (interface{}, error) {
+	refStr, ok := ref.(string)
+	if !ok {
+		return nil, fmt.Errorf("$ref must be a string, got %v", ref)
+	}
+	targetDoc, pointer := doc, ""
+	if p := strings.Index(refStr, "#"); p >= 0 {
+		if p > 0 {
+			targetDoc = refStr[:p]
+		}
+		pointer = refStr[p+1:]
+	} else {
+		targetDoc = refStr
+	}
+
+	targetRoot := root
+	if targetDoc != doc {
+		if self.library == nil {
+			return nil, fmt.Errorf("$ref %s needs a config library", refStr)
+		}
+		config, ok := self.library.Get(targetDoc)
+		if !ok {
+			return nil, fmt.Errorf("$ref %s: config %s not found", refStr, targetDoc)
+		}
+		targetRoot = config
+	}
+
+	key := targetDoc + "#" + pointer
+	for _, seen := range self.stack {
+		if seen == key {
+			return nil, fmt.Errorf("$ref cycle: %s -> %s", strings.Join(self.stack, " -> "), key)
+		}
+	}
+	target, err := jsonPointer(targetRoot, pointer)
+	if err != nil {
+		return nil, fmt.Errorf("$ref %s: %v", refStr, err)
+	}
+
+	self.stack = append(self.stack, key)
+	resolved, err := self.resolve(target, targetDoc, targetRoot)
+	self.stack = self.stack[:len(self.stack)-1]
+	if err != nil {
+		return nil, err
+	}
+	if len(m) == 1 {
+		return resolved, nil
+	}
+
+	fragment, ok := resolved.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("$ref %s: only object fragments can be overridden", refStr)
+	}
+	ret := make(map[string]interface{}, len(fragment)+len(m))
+	for k, v := range fragment {
+		ret[k] = v
+	}
+	for k, v := range m {
+		if k == REF_DEFINE {
+			continue
+		}
+		override, err := self.resolve(v, doc, root)
+		if err != nil {
+			return nil, err
+		}
+		ret[k] = override
+	}
+	return ret, nil
+}
+
+func jsonPointer(root interface{}, pointer string) (interface{}, error) {
+	if pointer == "" || pointer == "/" {
+		return root, nil
+	}
+	node := root
+	for _, token := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+		token = strings.Replace(token, "~1", "/", -1)
+		token = strings.Replace(token, "~0", "~", -1)
+		switch val := node.(type) {
+		case map[string]interface{}:
+			sub, ok := val[token]
+			if !ok {
+				return nil, fmt.Errorf("%s not found", token)
+			}
+			node = sub
+		case []interface{}:
+			index, err := strconv.Atoi(token)
+			if err != nil || index < 0 || index >= len(val) {
+				return nil, fmt.Errorf("index %s out of range", token)
+			}
+			node = val[index]
+		default:
+			return nil, fmt.Errorf("%s not found", token)
+		}
+	}
+	return node, nil
+}
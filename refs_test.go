@@ -0,0 +1,48 @@
+package extractor
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestResolveRefs(t *testing.T) {
+	extractor := NewExtractor()
+	config := `
+				{
+                    "_defs":{
+                        "seller":{"name":".seller .name", "level":".seller .level"}
+                    },
+                    "title":"h1",
+                    "seller":{"$ref":"#/_defs/seller", "level":".seller .star"}
+                }
+	`
+	data := []byte(`<html><body><h1>item</h1><div class="seller"><span class="name">shop</span><span class="star">5</span></div></body></html>`)
+	m := map[string]interface{}{}
+	json.Unmarshal([]byte(config), &m)
+	ret := extractor.Do(m, data).(map[string]interface{})
+	seller := ret["seller"].(map[string]interface{})
+	if seller["name"] != "shop" || seller["level"] != "5" {
+		t.Error(ret)
+	}
+	t.Log(ret)
+}
+
+func TestResolveRefsCycle(t *testing.T) {
+	extractor := NewExtractor()
+	config := `
+				{
+                    "_defs":{
+                        "a":{"b":{"$ref":"#/_defs/b"}},
+                        "b":{"a":{"$ref":"#/_defs/a"}}
+                    },
+                    "x":{"$ref":"#/_defs/a"}
+                }
+	`
+	m := map[string]interface{}{}
+	json.Unmarshal([]byte(config), &m)
+	_, err := extractor.ResolveRefs(m)
+	if err == nil {
+		t.Error("cycle not detected")
+	}
+	t.Log(err)
+}
@@ -0,0 +1,322 @@
+package extractor
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+)
+
+var (
+	blankLines    = regexp.MustCompile(`\n{3,}`)
+	lineSpaces    = regexp.MustCompile(`[ \t]+\n`)
+	markdownChars = strings.NewReplacer("*", `\*`, "_", `\_`, "`", "\\`")
+	blockElements = map[string]bool{
+		"address": true, "article": true, "aside": true, "blockquote": true, "dd": true,
+		"div": true, "dl": true, "dt": true, "fieldset": true, "figcaption": true,
+		"figure": true, "footer": true, "form": true, "h1": true, "h2": true, "h3": true,
+		"h4": true, "h5": true, "h6": true, "header": true, "hr": true, "li": true,
+		"main": true, "nav": true, "ol": true, "p": true, "pre": true, "section": true,
+		"table": true, "tr": true, "ul": true, "caption": true, "tbody": true,
+		"thead": true, "tfoot": true,
+	}
+	hiddenElements = map[string]bool{
+		"script": true, "style": true, "noscript": true, "template": true, "head": true,
+	}
+)
+
+// textWriter collapses whitespace the way browsers do and tracks the line
+// breaks requested by block elements.
+type textWriter struct {
+	buf      strings.Builder
+	newlines int
+	space    bool
+}
+
+func (self *textWriter) text(s string, pre bool) {
+	if pre {
+		self.flush()
+		self.buf.WriteString(s)
+		return
+	}
+	for _, r := range s {
+		if r == ' ' || r == '\t' || r == '\n' || r == '\r' || r == '\f' {
+			self.space = true
+			continue
+		}
+		if self.space && self.buf.Len() > 0 && self.newlines == 0 {
+			self.buf.WriteByte(' ')
+		}
+		self.space = false
+		self.flush()
+		self.buf.WriteRune(r)
+	}
+}
+
+// raw writes structural markup, dropping pending whitespace.
+func (self *textWriter) raw(s string) {
+	self.flush()
+	self.space = false
+	self.buf.WriteString(s)
+}
+
+// word writes inline markup, keeping pending whitespace before it.
+func (self *textWriter) word(s string) {
+	if self.space && self.buf.Len() > 0 && self.newlines == 0 {
+		self.buf.WriteByte(' ')
+	}
+	self.raw(s)
+}
+
+// breakLine asks for at least n line breaks before the next text.
+func (self *textWriter) breakLine(n int) {
+	if n == 0 || self.buf.Len() == 0 {
+		return
+	}
+	if n > self.newlines {
+		self.newlines = n
+	}
+	self.space = false
+}
+
+func (self *textWriter) flush() {
+	if self.newlines > 0 {
+		self.buf.WriteString(strings.Repeat("\n", self.newlines))
+		self.newlines = 0
+	}
+}
+
+func (self *textWriter) String() string {
+	return strings.TrimSpace(self.buf.String())
+}
+
+// InnerText renders s as browsers do for innerText: block elements start
+// new lines, paragraphs are separated by a blank line, <br> breaks the line
+// and table rows become tab separated lines.
+func InnerText(s *goquery.Selection) string {
+	w := &textWriter{}
+	for _, n := range s.Nodes {
+		innerText(w, n, false)
+	}
+	return w.String()
+}
+
+func innerText(w *textWriter, n *html.Node, pre bool) {
+	switch n.Type {
+	case html.TextNode:
+		w.text(n.Data, pre)
+		return
+	case html.ElementNode:
+	case html.DocumentNode:
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			innerText(w, c, pre)
+		}
+		return
+	default:
+		return
+	}
+	if hiddenElements[n.Data] {
+		return
+	}
+	switch n.Data {
+	case "br":
+		w.raw("\n")
+		return
+	case "td", "th":
+		if prev := prevElement(n); prev != nil {
+			w.raw("\t")
+		}
+	}
+	gap := 0
+	if blockElements[n.Data] {
+		gap = 1
+	}
+	if n.Data == "p" {
+		gap = 2
+	}
+	w.breakLine(gap)
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		innerText(w, c, pre || n.Data == "pre")
+	}
+	w.breakLine(gap)
+}
+
+func prevElement(n *html.Node) *html.Node {
+	for p := n.PrevSibling; p != nil; p = p.PrevSibling {
+		if p.Type == html.ElementNode {
+			return p
+		}
+	}
+	return nil
+}
+
+type markdownWriter struct {
+	textWriter
+	ex *Extractor
+}
+
+// Markdown converts s to Markdown with headings, paragraphs, emphasis,
+// links, images, lists, block quotes, code and tables. Links and images are
+// resolved with the extractor's base url.
+func (self *Extractor) Markdown(s *goquery.Selection) string {
+	w := &markdownWriter{ex: self}
+	for _, n := range s.Nodes {
+		w.node(n, 0, false)
+	}
+	return blankLines.ReplaceAllString(lineSpaces.ReplaceAllString(w.String(), "\n"), "\n\n")
+}
+
+func (self *markdownWriter) children(n *html.Node, depth int, pre bool) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		self.node(c, depth, pre)
+	}
+}
+
+// inline renders the children of n into a separate writer, used where the
+// content has to be wrapped or post-processed.
+func (self *markdownWriter) inline(n *html.Node, depth int) string {
+	sub := &markdownWriter{ex: self.ex}
+	sub.children(n, depth, false)
+	return sub.String()
+}
+
+func (self *markdownWriter) node(n *html.Node, depth int, pre bool) {
+	switch n.Type {
+	case html.TextNode:
+		if pre {
+			self.text(n.Data, true)
+		} else {
+			self.text(markdownChars.Replace(n.Data), false)
+		}
+		return
+	case html.DocumentNode:
+		self.children(n, depth, pre)
+		return
+	case html.ElementNode:
+	default:
+		return
+	}
+	if hiddenElements[n.Data] {
+		return
+	}
+
+	switch n.Data {
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		level, _ := strconv.Atoi(n.Data[1:])
+		self.breakLine(2)
+		self.raw(strings.Repeat("#", level) + " " + self.inline(n, depth))
+		self.breakLine(2)
+	case "p", "div", "section", "article", "header", "footer", "main", "figure", "dl":
+		self.breakLine(2)
+		self.children(n, depth, pre)
+		self.breakLine(2)
+	case "br":
+		self.raw("\\\n")
+	case "hr":
+		self.breakLine(2)
+		self.raw("---")
+		self.breakLine(2)
+	case "strong", "b":
+		if text := self.inline(n, depth); len(text) > 0 {
+			self.word("**" + text + "**")
+		}
+	case "em", "i":
+		if text := self.inline(n, depth); len(text) > 0 {
+			self.word("*" + text + "*")
+		}
+	case "code":
+		if pre {
+			self.children(n, depth, true)
+		} else if text := normalizeSpace(goquery.NewDocumentFromNode(n).Text()); len(text) > 0 {
+			self.word("`" + text + "`")
+		}
+	case "pre":
+		self.breakLine(2)
+		self.raw("```\n")
+		self.children(n, depth, true)
+		self.raw("\n```")
+		self.breakLine(2)
+	case "a":
+		text := self.inline(n, depth)
+		href := self.ex.absURL(nodeAttr(n, "href"))
+		if len(href) == 0 || strings.HasPrefix(href, "javascript:") {
+			self.word(text)
+		} else if len(text) > 0 {
+			self.word("[" + text + "](" + href + ")")
+		}
+	case "img":
+		src := imageCandidate(imgPriority, goquery.NewDocumentFromNode(n).Selection)
+		if len(src) > 0 {
+			self.word("![" + nodeAttr(n, "alt") + "](" + self.ex.absURL(src) + ")")
+		}
+	case "ul", "ol":
+		self.breakLine(2)
+		index := 1
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type != html.ElementNode || c.Data != "li" {
+				continue
+			}
+			marker := "- "
+			if n.Data == "ol" {
+				marker = strconv.Itoa(index) + ". "
+				index++
+			}
+			indent := strings.Repeat("  ", depth)
+			item := self.inline(c, depth+1)
+			item = strings.Replace(item, "\n\n", "\n", -1)
+			item = strings.Replace(item, "\n", "\n"+indent+strings.Repeat(" ", len(marker)), -1)
+			self.breakLine(1)
+			self.raw(indent + marker + item)
+		}
+		self.breakLine(2)
+	case "blockquote":
+		self.breakLine(2)
+		text := self.inline(n, depth)
+		self.raw("> " + strings.Replace(text, "\n", "\n> ", -1))
+		self.breakLine(2)
+	case "table":
+		self.breakLine(2)
+		self.raw(self.table(n))
+		self.breakLine(2)
+	default:
+		self.children(n, depth, pre)
+	}
+}
+
+func (self *markdownWriter) table(n *html.Node) string {
+	rows := [][]string{}
+	goquery.NewDocumentFromNode(n).Find("tr").Each(func(i int, tr *goquery.Selection) {
+		if tr.Closest("table").Get(0) != n {
+			return
+		}
+		row := []string{}
+		tr.Children().Filter("th,td").Each(func(i int, cell *goquery.Selection) {
+			text := self.inline(cell.Get(0), 0)
+			text = strings.Replace(text, "\n", " ", -1)
+			row = append(row, strings.Replace(text, "|", `\|`, -1))
+		})
+		rows = append(rows, row)
+	})
+	if len(rows) == 0 {
+		return ""
+	}
+	width := 0
+	for _, row := range rows {
+		if len(row) > width {
+			width = len(row)
+		}
+	}
+	lines := []string{}
+	for i, row := range rows {
+		for len(row) < width {
+			row = append(row, "")
+		}
+		lines = append(lines, "| "+strings.Join(row, " | ")+" |")
+		if i == 0 {
+			lines = append(lines, "|"+strings.Repeat(" --- |", width))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
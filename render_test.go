@@ -0,0 +1,38 @@
+package extractor
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+var renderPage = []byte(`<html><body><div class="desc">
+	<h2>Notice</h2>
+	<p>Repay <b>before</b> the <a href="/due">due date</a>.<br>Late fees apply.</p>
+	<ul><li>First <em>item</em></li><li>Second item</li></ul>
+	<table><tr><th>Term</th><th>Amount</th></tr><tr><td>1</td><td>100.00</td></tr></table>
+	<img src="//img.example.com/a.png" alt="banner">
+	</div></body></html>`)
+
+func TestInnerText(t *testing.T) {
+	config := `{"text":"div.desc;innertext"}`
+	m := map[string]interface{}{}
+	json.Unmarshal([]byte(config), &m)
+	ret := NewExtractor().Do(m, renderPage).(map[string]interface{})
+	expected := "Notice\n\nRepay before the due date.\nLate fees apply.\n\nFirst item\nSecond item\nTerm\tAmount\n1\t100.00"
+	if ret["text"] != expected {
+		t.Errorf("%q", ret["text"])
+	}
+}
+
+func TestMarkdown(t *testing.T) {
+	config := `{"text":"div.desc;markdown"}`
+	m := map[string]interface{}{}
+	json.Unmarshal([]byte(config), &m)
+	extractor := NewExtractor()
+	extractor.BaseURL = "http://www.example.com/notice/1"
+	ret := extractor.Do(m, renderPage).(map[string]interface{})
+	expected := "## Notice\n\nRepay **before** the [due date](http://www.example.com/due).\\\nLate fees apply.\n\n- First *item*\n- Second item\n\n| Term | Amount |\n| --- | --- |\n| 1 | 100.00 |\n\n![banner](http://img.example.com/a.png)"
+	if ret["text"] != expected {
+		t.Errorf("%q", ret["text"])
+	}
+}
@@ -0,0 +1,96 @@
+package extractor
+
+import (
+	"fmt"
+	"time"
+)
+
+type ExtractRequest struct {
+	Config     interface{}       `json:"config,omitempty"`
+	ConfigName string            `json:"config_name,omitempty"`
+	Body       []byte            `json:"body"`
+	Type       string            `json:"type,omitempty"`
+	BaseURL    string            `json:"base_url,omitempty"`
+	Vars       map[string]string `json:"vars,omitempty"`
+	Trace      bool              `json:"trace,omitempty"`
+}
+
+type ExtractResponse struct {
+	Result   interface{}   `json:"result"`
+	Errors   []string      `json:"errors,omitempty"`
+	Trace    interface{}   `json:"trace,omitempty"`
+	Duration time.Duration `json:"duration"`
+}
+
+func (self *ExtractRequest) config(ex *Extractor) (interface{}, error) {
+	config := self.Config
+	if len(self.ConfigName) > 0 {
+		named, err := ex.namedConfig(self.ConfigName)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+		}
+		config = named
+	}
+	if config == nil {
+		return nil, fmt.Errorf("%w: config or config_name is required", ErrInvalidConfig)
+	}
+	if len(self.Type) == 0 {
+		return config, nil
+	}
+	switch c := config.(type) {
+	case map[string]interface{}:
+		typed := make(map[string]interface{}, len(c)+1)
+		for k, v := range c {
+			typed[k] = v
+		}
+		delete(typed, JSONTYPE_DEFINE)
+		typed[TYPE_DEFINE] = self.Type
+		return typed, nil
+	case []interface{}:
+		return append([]interface{}{self.Type}, c...), nil
+	}
+	return config, nil
+}
+
+// DoRequest runs one ExtractRequest. The extraction runs on a copy of the
+// extractor so that BaseURL and Vars only apply to this request. The error
+// returned is also listed in the response.
+func (self *Extractor) DoRequest(req *ExtractRequest) (*ExtractResponse, error) {
+	start := time.Now()
+	resp := &ExtractResponse{}
+	ex := *self
+	ex.BaseURL = req.BaseURL
+	ex.Vars = req.Vars
+	if req.Trace {
+		ex.trace = &Trace{Field: "$"}
+	}
+
+	config, err := req.config(&ex)
+	if err == nil {
+		resp.Result, err = ex.Parse(config, req.Body)
+		if err == nil && resp.Result == nil {
+			err = fmt.Errorf("%w: return nil", ErrExtract)
+		}
+	}
+	if err != nil {
+		resp.Errors = append(resp.Errors, err.Error())
+	}
+	if ex.trace != nil {
+		if err != nil {
+			ex.trace.Error = err.Error()
+		}
+		ex.trace.Duration = time.Since(start)
+		resp.Trace = ex.trace
+	}
+	if self.Drift != nil && len(req.ConfigName) > 0 && err == nil {
+		self.Drift.Record(req.ConfigName, resp.Result)
+	}
+	resp.Duration = time.Since(start)
+	return resp, err
+}
+
+func (self *Extractor) Extract(req ExtractRequest, resp *ExtractResponse) error {
+	ret, _ := self.DoRequest(&req)
+	*resp = *ret
+	return nil
+}
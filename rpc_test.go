@@ -0,0 +1,63 @@
+package extractor
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExtract(t *testing.T) {
+	extractor := NewExtractor()
+	params := `
+				{
+                    "config":{"link":"a.[$kind];href"},
+                    "body":"PGEgY2xhc3M9Iml0ZW0iIGhyZWY9Ii4uL2l0ZW0vMSI+b25lPC9hPg==",
+                    "base_url":"http://www.example.com/list/page",
+                    "vars":{"kind":"item"}
+                }
+	`
+	req := ExtractRequest{}
+	if err := json.Unmarshal([]byte(params), &req); err != nil {
+		t.Fatal(err)
+	}
+	resp := ExtractResponse{}
+	extractor.Extract(req, &resp)
+	ret := resp.Result.(map[string]interface{})
+	if ret["link"] != "http://www.example.com/item/1" {
+		t.Error(resp)
+	}
+	t.Log(resp)
+}
+
+func TestDoRequestInvalidConfig(t *testing.T) {
+	extractor := NewExtractor()
+	resp, err := extractor.DoRequest(&ExtractRequest{ConfigName: "missing"})
+	if !errors.Is(err, ErrInvalidConfig) || len(resp.Errors) != 1 {
+		t.Error(err, resp)
+	}
+}
+
+func TestDoRequestDrift(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "drift")
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "item.json"), []byte(`{"title":"h1"}`), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "list.json"), []byte(`{"_root":"ul","name":"li"}`), 0644)
+	extractor := NewExtractor()
+	extractor.Library = NewConfigLibrary(dir)
+	extractor.Library.Load()
+	extractor.Drift, _ = NewDriftStore(filepath.Join(dir, "drift.json"))
+
+	body := []byte("<h1>A</h1>")
+	if _, err := extractor.DoRequest(&ExtractRequest{ConfigName: "item", Body: body}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := extractor.DoRequest(&ExtractRequest{ConfigName: "list", Body: body}); !errors.Is(err, ErrExtract) {
+		t.Fatal(err)
+	}
+	if configs := extractor.Drift.Configs(); len(configs) != 1 || configs[0] != "item" {
+		t.Error("failed extraction recorded as drift", configs)
+	}
+}
@@ -0,0 +1,377 @@
+package extractor
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/xlvector/dlog"
+)
+
+// The selector mini-language is
+//
+//	path [ ";" attr [ ";" regex ] ] [ ">|" template ]
+//
+// where path is a css selector or json path. A ";" or ">|" inside quotes
+// (path only), brackets or parentheses does not end a segment, "\;" and
+// "\>" stand for the bare characters, and a whole segment may be wrapped in
+// backquotes to be taken literally, e.g. a;`x;y`. The template is always
+// the raw rest of the selector.
+
+const (
+	segmentPath = iota
+	segmentAttr
+	segmentRegex
+)
+
+var segmentNames = []string{"path", "attribute", "regex"}
+
+// SelectorPart is one segment of a parsed selector and the column it
+// starts at.
+type SelectorPart struct {
+	Text   string
+	Col    int
+	Quoted bool
+}
+
+// SelectorAST is a parsed selector. Attr, Regex and Template are nil when
+// the selector does not have them, which keeps "a;" apart from "a".
+type SelectorAST struct {
+	Path     *SelectorPart
+	Attr     *SelectorPart
+	Regex    *SelectorPart
+	Template *SelectorPart
+}
+
+// SyntaxError reports where a selector stopped making sense. Col counts
+// characters from 1.
+type SyntaxError struct {
+	Selector string
+	Col      int
+	Msg      string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("selector %q: column %d: %s", e.Selector, e.Col, e.Msg)
+}
+
+func (e *SyntaxError) Unwrap() error {
+	return ErrInvalidConfig
+}
+
+type selectorLexer struct {
+	input string
+	pos   int
+}
+
+func (l *selectorLexer) col(pos int) int {
+	return utf8.RuneCountInString(l.input[:pos]) + 1
+}
+
+func (l *selectorLexer) errorf(pos int, format string, args ...interface{}) *SyntaxError {
+	return &SyntaxError{Selector: l.input, Col: l.col(pos), Msg: fmt.Sprintf(format, args...)}
+}
+
+func (l *selectorLexer) atTemplate() bool {
+	return strings.HasPrefix(l.input[l.pos:], ">|")
+}
+
+// segment reads one segment up to the next unprotected ";" or ">|".
+func (l *selectorLexer) segment(kind int) (*SelectorPart, error) {
+	part := &SelectorPart{Col: l.col(l.pos)}
+	if l.pos < len(l.input) && l.input[l.pos] == '`' {
+		return part, l.quoted(part)
+	}
+	var buf strings.Builder
+	var stack []int
+	quote, quotePos := byte(0), 0
+	for l.pos < len(l.input) {
+		c := l.input[l.pos]
+		if c == '\\' && l.pos+1 < len(l.input) {
+			next := l.input[l.pos+1]
+			if next != ';' && next != '>' && next != '`' {
+				buf.WriteByte(c)
+			}
+			buf.WriteByte(next)
+			l.pos += 2
+			continue
+		}
+		if quote != 0 {
+			if c == quote {
+				quote = 0
+			}
+			buf.WriteByte(c)
+			l.pos++
+			continue
+		}
+		inClass := len(stack) > 0 && l.input[stack[len(stack)-1]] == '['
+		switch {
+		case kind == segmentPath && (c == '\'' || c == '"'):
+			quote, quotePos = c, l.pos
+		case c == '[' && !inClass, c == '(' && !inClass:
+			stack = append(stack, l.pos)
+		case c == ']' && inClass:
+			stack = stack[:len(stack)-1]
+		case c == ')' && !inClass:
+			if len(stack) == 0 {
+				return nil, l.errorf(l.pos, "unexpected ) in %s", segmentNames[kind])
+			}
+			stack = stack[:len(stack)-1]
+		case len(stack) == 0 && (c == ';' || l.atTemplate()):
+			part.Text = buf.String()
+			return part, nil
+		}
+		buf.WriteByte(c)
+		l.pos++
+	}
+	if quote != 0 {
+		return nil, l.errorf(quotePos, "unterminated %c quote", quote)
+	}
+	if len(stack) > 0 {
+		open := stack[len(stack)-1]
+		return nil, l.errorf(open, "unclosed %c in %s", l.input[open], segmentNames[kind])
+	}
+	part.Text = buf.String()
+	return part, nil
+}
+
+// quoted reads a backquoted segment, where "\`" and "\\" are escapes.
+func (l *selectorLexer) quoted(part *SelectorPart) error {
+	start := l.pos
+	l.pos++
+	var buf strings.Builder
+	for l.pos < len(l.input) {
+		c := l.input[l.pos]
+		if c == '\\' && l.pos+1 < len(l.input) && (l.input[l.pos+1] == '`' || l.input[l.pos+1] == '\\') {
+			buf.WriteByte(l.input[l.pos+1])
+			l.pos += 2
+			continue
+		}
+		l.pos++
+		if c == '`' {
+			part.Text, part.Quoted = buf.String(), true
+			if l.pos < len(l.input) && l.input[l.pos] != ';' && !l.atTemplate() {
+				return l.errorf(l.pos, "unexpected %q after quoted segment", l.input[l.pos])
+			}
+			return nil
+		}
+		buf.WriteByte(c)
+	}
+	return l.errorf(start, "unterminated ` quote")
+}
+
+// ParseSelector parses a selector into its segments.
+func ParseSelector(v string) (*SelectorAST, error) {
+	l := &selectorLexer{input: v}
+	ret := &SelectorAST{}
+	parts := []**SelectorPart{&ret.Path, &ret.Attr, &ret.Regex}
+	for kind := segmentPath; ; kind++ {
+		part, err := l.segment(kind)
+		if err != nil {
+			return nil, err
+		}
+		*parts[kind] = part
+		if l.pos >= len(l.input) {
+			return ret, nil
+		}
+		if l.atTemplate() {
+			ret.Template = &SelectorPart{Text: v[l.pos+2:], Col: l.col(l.pos + 2)}
+			return ret, nil
+		}
+		if kind == segmentRegex {
+			return nil, l.errorf(l.pos, "unexpected ; after regex, quote the regex with `")
+		}
+		l.pos++
+	}
+}
+
+// String formats the selector canonically. Segments are written bare
+// unless they would not read back the same, in which case they are
+// backquoted, so old style selectors come back unchanged.
+func (s *SelectorAST) String() string {
+	var buf strings.Builder
+	parts := []*SelectorPart{s.Path, s.Attr, s.Regex}
+	for kind, part := range parts {
+		if part == nil {
+			break
+		}
+		if kind > segmentPath {
+			buf.WriteByte(';')
+		}
+		buf.WriteString(formatSegment(part.Text, kind))
+	}
+	if s.Template != nil {
+		buf.WriteString(">|")
+		buf.WriteString(s.Template.Text)
+	}
+	return buf.String()
+}
+
+func formatSegment(text string, kind int) string {
+	l := &selectorLexer{input: text}
+	if part, err := l.segment(kind); err == nil && l.pos == len(text) && part.Text == text && !strings.HasPrefix(text, "`") {
+		return text
+	}
+	var buf strings.Builder
+	buf.WriteByte('`')
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		if c == '`' || c == '\\' && (i+1 == len(text) || text[i+1] == '`' || text[i+1] == '\\') {
+			buf.WriteByte('\\')
+		}
+		buf.WriteByte(c)
+	}
+	buf.WriteByte('`')
+	return buf.String()
+}
+
+// FormatSelector returns the canonical form of a selector.
+func FormatSelector(v string) (string, error) {
+	ast, err := ParseSelector(v)
+	if err != nil {
+		return "", err
+	}
+	return ast.String(), nil
+}
+
+// text returns the segment text or "" when it is absent.
+func (p *SelectorPart) text() string {
+	if p == nil {
+		return ""
+	}
+	return p.Text
+}
+
+// legacySplit is how selectors were split before ParseSelector, kept for
+// configs written against it, see Extractor.LegacySelectors.
+func legacySplit(v string) *SelectorAST {
+	ret := &SelectorAST{}
+	if strings.Contains(v, ">|") {
+		tks := strings.Split(v, ">|")
+		v = tks[0]
+		ret.Template = &SelectorPart{Text: tks[1]}
+	}
+	tks := strings.Split(v, ";")
+	ret.Path = &SelectorPart{Text: tks[0]}
+	if len(tks) > 1 {
+		ret.Attr = &SelectorPart{Text: tks[1]}
+	}
+	if len(tks) > 2 {
+		ret.Regex = &SelectorPart{Text: tks[2]}
+	}
+	return ret
+}
+
+// parseSelector parses v for extraction. A selector that does not follow
+// the grammar is split the legacy way when legacy is set, and is otherwise
+// taken whole as a path, which matches nothing.
+func parseSelector(v string, legacy bool) *SelectorAST {
+	ast, err := ParseSelector(v)
+	if err == nil {
+		return ast
+	}
+	if legacy {
+		return legacySplit(v)
+	}
+	dlog.Warn("%s", err.Error())
+	return &SelectorAST{Path: &SelectorPart{Text: v}}
+}
+
+// checkSelectors returns the first selector of config that does not parse:
+// a *SyntaxError for one outside the grammar, unless LegacySelectors is set,
+// or the error of an html path with a bad modifier chain, _root included.
+// The fields of string configs are regexes and are not checked.
+func (self *Extractor) checkSelectors(config interface{}) error {
+	switch c := config.(type) {
+	case map[string]interface{}:
+		return self.checkRecord(c, "html")
+	case []interface{}:
+		dataType := "html"
+		for _, single := range c {
+			v, _ := single.(string)
+			switch v {
+			case "_html", "html":
+				dataType = "html"
+			case "_json", "json":
+				dataType = "json"
+			case "_string", "string":
+				dataType = "string"
+			default:
+				if err := self.checkSelector(v, dataType); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (self *Extractor) checkRecord(m map[string]interface{}, dataType string) error {
+	_, typed := m[TYPE_DEFINE]
+	if _, ok := m[JSONTYPE_DEFINE]; ok || typed {
+		dataType = self.dataType(m)
+	}
+	if dataType == "string" {
+		return nil
+	}
+	if _, ok := m[ROOT_DEFINE].(string); ok && dataType == "html" {
+		rt := strings.Replace(self.root(m), "@array", "", 1)
+		if rt != AUTO_ROOT {
+			if _, _, err := parseXpath(rt); err != nil {
+				return err
+			}
+		}
+	}
+	for key, val := range m {
+		if strings.HasPrefix(key, "_") {
+			continue
+		}
+		if strings.HasPrefix(key, "@key") {
+			if err := self.checkSelector(strings.Replace(key, "@key", "", -1), dataType); err != nil {
+				return err
+			}
+		}
+		var err error
+		switch v := val.(type) {
+		case string:
+			err = self.checkSelector(v, dataType)
+		case map[string]interface{}:
+			err = self.checkRecord(v, dataType)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (self *Extractor) checkSelector(v string, dataType string) error {
+	if dataType == "string" {
+		return nil
+	}
+	if self.Filter != nil {
+		if val, isFilter := self.Filter(v); isFilter {
+			return nil
+		} else if len(val) > 0 {
+			v = val
+		}
+	}
+	ast, err := ParseSelector(v)
+	if err != nil {
+		if !self.LegacySelectors {
+			return err
+		}
+		ast = legacySplit(v)
+	}
+	if dataType != "html" || v == "@data" || strings.Contains(v, "@label(") ||
+		strings.HasPrefix(v, "@jsonld") || strings.HasPrefix(v, ARTICLE_SELECTOR) {
+		return nil
+	}
+	// table fields name their cell with @col(header) before the selector
+	xpath := newHtmlSelector(ast).Xpath
+	if group := colRegex.FindStringSubmatch(xpath); group != nil {
+		xpath = xpath[len(group[0]):]
+	}
+	_, _, err = parseXpath(xpath)
+	return err
+}
@@ -0,0 +1,113 @@
+package extractor
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseSelector(t *testing.T) {
+	cases := []struct {
+		selector                    string
+		path, attr, regex, template string
+	}{
+		{"div.price span", "div.price span", "", "", ""},
+		{"a;href", "a", "href", "", ""},
+		{"p.num;;([\\d.]+)>|{{.}}元", "p.num", "", "([\\d.]+)", "{{.}}元"},
+		{"input[value='a;b'];value", "input[value='a;b']", "value", "", ""},
+		{"p;;([^;]+);", "", "", "", ""},
+		{"p;;`a;b`>|x>|y", "p", "", "a;b", "x>|y"},
+		{"p;;a\\;b", "p", "", "a;b", ""},
+		{"td:contains(x;y) @next;;(a>|b)", "td:contains(x;y) @next", "", "(a>|b)", ""},
+		{"data.list[0].name;true", "data.list[0].name", "true", "", ""},
+	}
+	for _, c := range cases {
+		ast, err := ParseSelector(c.selector)
+		if c.path == "" {
+			if err == nil {
+				t.Errorf("%s: expected an error", c.selector)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", c.selector, err)
+			continue
+		}
+		if ast.Path.text() != c.path || ast.Attr.text() != c.attr || ast.Regex.text() != c.regex || ast.Template.text() != c.template {
+			t.Errorf("%s: %q %q %q %q", c.selector, ast.Path.text(), ast.Attr.text(), ast.Regex.text(), ast.Template.text())
+		}
+	}
+}
+
+func TestSelectorSyntaxError(t *testing.T) {
+	cases := map[string]int{
+		"a[href='x;href":   8,
+		"li:not(.hot;text": 7,
+		"金额 span);text":    8,
+		"p;;`abc":          4,
+		"p;;`a`b":          7,
+		"p;;(\\d+);x":      9,
+	}
+	for selector, col := range cases {
+		_, err := ParseSelector(selector)
+		var syntax *SyntaxError
+		if !errors.As(err, &syntax) || syntax.Col != col || !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("%s: %v", selector, err)
+		}
+	}
+}
+
+func TestFormatSelector(t *testing.T) {
+	for _, selector := range []string{
+		"div.price span",
+		"a;href",
+		"p.num;;([\\d.]+)>|{{.}}元",
+		"ul li@all(unique,noempty);src",
+		"a;",
+		"p;;@multi (\\d+)",
+		"span.label @closest(tr) @children(td) @eq(-2);html",
+		"p;;`a;b`",
+		"p;;`(a;b`",
+	} {
+		formatted, err := FormatSelector(selector)
+		if err != nil || formatted != selector {
+			t.Errorf("%s: %s %v", selector, formatted, err)
+		}
+	}
+	formatted, _ := FormatSelector("p;;a\\;b")
+	if formatted != "p;;`a;b`" {
+		t.Error(formatted)
+	}
+	if sel := NewHtmlSelector("p;;([^;]+)"); sel.Regex != "([^;]+)" {
+		t.Error(sel.Regex)
+	}
+	if sel := NewHtmlSelector("p;;([^;]+)x;y"); sel.Xpath != "p;;([^;]+)x;y" || sel.Regex != "" {
+		t.Error(sel)
+	}
+}
+
+func TestParseInvalidSelector(t *testing.T) {
+	body := []byte("<p>1;2</p>")
+	for _, config := range []interface{}{
+		map[string]interface{}{"num": "p;;([^;]+)x;y"},
+		map[string]interface{}{"item": map[string]interface{}{"num": "p;;([^;]+)x;y"}},
+		map[string]interface{}{"@keyp;;(": "p"},
+		[]interface{}{"p;;([^;]+)x;y"},
+	} {
+		_, err := NewExtractor().Parse(config, body)
+		var syntax *SyntaxError
+		if !errors.As(err, &syntax) || !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("%v: %v", config, err)
+		}
+	}
+	// string configs hold regexes, not selectors
+	if ret, err := NewExtractor().Parse(map[string]interface{}{"_type": "string", "num": "(\\d);"}, body); err != nil {
+		t.Error(ret, err)
+	}
+
+	ex := NewExtractor()
+	ex.LegacySelectors = true
+	ret, err := ex.Parse(map[string]interface{}{"num": "p;;(\\d+);x"}, body)
+	if err != nil || ret.(map[string]interface{})["num"] != "1" {
+		t.Error(ret, err)
+	}
+}
@@ -0,0 +1,339 @@
+package extractor
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/xlvector/dlog"
+)
+
+// numericRegex matches a whole number with an optional currency before it
+// and an optional unit after it, e.g. "¥1,299.00", "US$ 5" or "12件".
+var numericRegex = regexp.MustCompile(`^(?i:([¥￥$€£₩₹]|[A-Z]{2}\$|RMB|CNY|USD|EUR|GBP|JPY|HKD)\s*)?([+\-]?(?:\d{1,3}(?:,\d{3})+|\d+)(?:\.\d+)?)(?:\s*(\D{1,8}))?$`)
+
+// parseNumber reads v as a number and the currency and unit around it.
+// Strings are numbers only when nothing but a currency, a unit and
+// thousands separators surround the digits, so "SKU-1024" is not one.
+func parseNumber(v interface{}) (float64, string, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, "", true
+	case int:
+		return float64(n), "", true
+	case int64:
+		return float64(n), "", true
+	case json.Number:
+		f, err := n.Float64()
+		return f, "", err == nil
+	case string:
+		m := numericRegex.FindStringSubmatch(strings.TrimSpace(n))
+		if m == nil {
+			return 0, "", false
+		}
+		f, err := strconv.ParseFloat(strings.Replace(m[2], ",", "", -1), 64)
+		return f, m[1] + m[3], err == nil
+	}
+	return 0, "", false
+}
+
+// toNumber reads v as a number, allowing thousands separators and a
+// currency or unit around it, e.g. "¥1,299.00" or "12件".
+func toNumber(v interface{}) (float64, bool) {
+	f, _, ok := parseNumber(v)
+	return f, ok
+}
+
+func toInt(v interface{}) (int, bool) {
+	if n, ok := toNumber(v); ok {
+		return int(n), true
+	}
+	return 0, false
+}
+
+func valueString(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return val
+	}
+	return fmt.Sprint(v)
+}
+
+func isEmptyValue(v interface{}) bool {
+	switch val := v.(type) {
+	case nil:
+		return true
+	case string:
+		return len(val) == 0
+	case []interface{}:
+		return len(val) == 0
+	case []string:
+		return len(val) == 0
+	case map[string]interface{}:
+		return len(val) == 0
+	}
+	return false
+}
+
+// fieldValue looks up a dotted field path in a record.
+func fieldValue(record map[string]interface{}, field string) interface{} {
+	var v interface{} = record
+	for _, key := range strings.Split(field, ".") {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		v = m[key]
+	}
+	return v
+}
+
+var predicateOps = []string{">=", "<=", "!=", "!~", ">", "<", "=", "~"}
+
+// matchPredicate tests a field value against a _where predicate: a literal
+// to compare with, or a string starting with one of >=, <=, !=, !~, >, <,
+// = and ~ (regex). Comparisons are numeric when both sides are numbers.
+func matchPredicate(v interface{}, predicate interface{}) bool {
+	switch p := predicate.(type) {
+	case nil:
+		return isEmptyValue(v)
+	case []interface{}:
+		for _, sub := range p {
+			if !matchPredicate(v, sub) {
+				return false
+			}
+		}
+		return true
+	case string:
+		op, operand := "=", p
+		for _, candidate := range predicateOps {
+			if strings.HasPrefix(p, candidate) {
+				op, operand = candidate, strings.TrimSpace(p[len(candidate):])
+				break
+			}
+		}
+		text := valueString(v)
+		switch op {
+		case "~", "!~":
+			reg, err := regexp.Compile(operand)
+			if err != nil {
+				dlog.Warn("_where regex %s error:%s", operand, err.Error())
+				return false
+			}
+			return reg.MatchString(text) == (op == "~")
+		}
+		cmp := compareValues(v, operand)
+		switch op {
+		case "=":
+			return cmp == 0
+		case "!=":
+			return cmp != 0
+		case ">":
+			return !isEmptyValue(v) && cmp > 0
+		case ">=":
+			return !isEmptyValue(v) && cmp >= 0
+		case "<":
+			return !isEmptyValue(v) && cmp < 0
+		case "<=":
+			return !isEmptyValue(v) && cmp <= 0
+		}
+	}
+	return compareValues(v, predicate) == 0
+}
+
+// compareValues orders two values numerically when both are numbers in the
+// same unit, or one of them is a bare number, and as strings otherwise.
+func compareValues(a, b interface{}) int {
+	if x, xu, ok := parseNumber(a); ok {
+		if y, yu, ok := parseNumber(b); ok && (xu == yu || len(xu) == 0 || len(yu) == 0) {
+			switch {
+			case x < y:
+				return -1
+			case x > y:
+				return 1
+			}
+			return 0
+		}
+	}
+	return strings.Compare(valueString(a), valueString(b))
+}
+
+type sortKey struct {
+	field   string
+	desc    bool
+	numeric bool
+	text    bool
+}
+
+// parseSortKeys reads _sort: "field", "-field" or "field desc num", or an
+// array of them for ties.
+func parseSortKeys(v interface{}) []sortKey {
+	specs := []string{}
+	switch val := v.(type) {
+	case string:
+		specs = append(specs, val)
+	case []interface{}:
+		for _, spec := range val {
+			specs = append(specs, valueString(spec))
+		}
+	}
+	ret := []sortKey{}
+	for _, spec := range specs {
+		tks := strings.Fields(spec)
+		if len(tks) == 0 {
+			continue
+		}
+		key := sortKey{field: tks[0]}
+		if strings.HasPrefix(key.field, "-") {
+			key.field, key.desc = key.field[1:], true
+		}
+		for _, tk := range tks[1:] {
+			switch strings.ToLower(tk) {
+			case "desc":
+				key.desc = true
+			case "asc":
+				key.desc = false
+			case "num", "numeric":
+				key.numeric = true
+			case "str", "string":
+				key.text = true
+			}
+		}
+		ret = append(ret, key)
+	}
+	return ret
+}
+
+func (key sortKey) compare(a, b interface{}) int {
+	// empty values go last whatever the order
+	if ea, eb := isEmptyValue(a), isEmptyValue(b); ea || eb {
+		switch {
+		case ea && eb:
+			return 0
+		case ea:
+			return 1
+		}
+		return -1
+	}
+	cmp := 0
+	if key.text {
+		cmp = strings.Compare(valueString(a), valueString(b))
+	} else if key.numeric {
+		x, _ := toNumber(a)
+		y, _ := toNumber(b)
+		cmp = compareValues(x, y)
+	} else {
+		cmp = compareValues(a, b)
+	}
+	if key.desc {
+		return -cmp
+	}
+	return cmp
+}
+
+func uniqueFields(v interface{}) []string {
+	switch val := v.(type) {
+	case string:
+		return []string{val}
+	case []interface{}:
+		ret := []string{}
+		for _, field := range val {
+			ret = append(ret, valueString(field))
+		}
+		return ret
+	case bool:
+		if val {
+			return []string{}
+		}
+	}
+	return nil
+}
+
+// hasShape reports whether m asks for any of the array shaping keys.
+func hasShape(m map[string]interface{}) bool {
+	for _, key := range []string{WHERE_DEFINE, UNIQUE_DEFINE, SORT_DEFINE, LIMIT_DEFINE, OFFSET_DEFINE, SKIPEMPTY_DEFINE} {
+		if _, ok := m[key]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// shape applies the _skipempty, _where, _unique, _sort, _offset and _limit
+// keys of m to the records of an array result, in that order. A _root with
+// any of these keys always gives an array, even when it matches once.
+func shape(m map[string]interface{}, records []map[string]interface{}) []map[string]interface{} {
+	if !hasShape(m) {
+		return records
+	}
+	where, _ := m[WHERE_DEFINE].(map[string]interface{})
+	unique := uniqueFields(m[UNIQUE_DEFINE])
+	seen := map[string]bool{}
+	ret := []map[string]interface{}{}
+	for _, record := range records {
+		if m[SKIPEMPTY_DEFINE] == true {
+			empty := true
+			for _, v := range record {
+				if !isEmptyValue(v) {
+					empty = false
+					break
+				}
+			}
+			if empty {
+				continue
+			}
+		}
+		matched := true
+		for field, predicate := range where {
+			if !matchPredicate(fieldValue(record, field), predicate) {
+				matched = false
+				break
+			}
+		}
+		if !matched {
+			continue
+		}
+		if unique != nil {
+			var key []byte
+			if len(unique) == 0 {
+				key, _ = json.Marshal(record)
+			} else {
+				values := []interface{}{}
+				for _, field := range unique {
+					values = append(values, fieldValue(record, field))
+				}
+				key, _ = json.Marshal(values)
+			}
+			if seen[string(key)] {
+				continue
+			}
+			seen[string(key)] = true
+		}
+		ret = append(ret, record)
+	}
+	if keys := parseSortKeys(m[SORT_DEFINE]); len(keys) > 0 {
+		sort.SliceStable(ret, func(i, j int) bool {
+			for _, key := range keys {
+				if cmp := key.compare(fieldValue(ret[i], key.field), fieldValue(ret[j], key.field)); cmp != 0 {
+					return cmp < 0
+				}
+			}
+			return false
+		})
+	}
+	if offset, ok := toInt(m[OFFSET_DEFINE]); ok && offset > 0 {
+		if offset > len(ret) {
+			offset = len(ret)
+		}
+		ret = ret[offset:]
+	}
+	if limit, ok := toInt(m[LIMIT_DEFINE]); ok && limit >= 0 && limit < len(ret) {
+		ret = ret[:limit]
+	}
+	return ret
+}
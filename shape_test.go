@@ -0,0 +1,118 @@
+package extractor
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestShapeHtml(t *testing.T) {
+	body := []byte(`<html><body><ul>
+		<li><a href="/1">Phone</a><span class="price">¥1,299.00</span><i>3C</i></li>
+		<li><a href="/2">Case</a><span class="price">¥19.90</span><i>配件</i></li>
+		<li><a href="/3">Phone</a><span class="price">¥1,099.00</span><i>3C</i></li>
+		<li><a href="/4">Laptop</a><span class="price">¥5,999.00</span><i>3C</i></li>
+		<li class="ad"></li>
+		<li><a href="/5">Cable</a><span class="price">¥9.90</span><i>配件</i></li>
+	</ul></body></html>`)
+	config := `{
+		"all":{"_root":"li", "_skipempty":true, "name":"a", "price":"span.price"},
+		"cheap":{"_root":"li", "_where":{"price":"<100", "tag":"配件"}, "_sort":"price num", "name":"a", "price":"span.price", "tag":"i"},
+		"top":{"_root":"li", "_where":{"name":"!=", "tag":["~^3C$"]}, "_unique":"name", "_sort":"-price", "_limit":2, "name":"a", "price":"span.price", "tag":"i"},
+		"page":{"_root":"li", "_skipempty":true, "_sort":["tag", "price desc"], "_offset":1, "_limit":2, "name":"a", "tag":"i", "price":"span.price"}
+	}`
+	m := map[string]interface{}{}
+	json.Unmarshal([]byte(config), &m)
+	ret := NewExtractor().Do(m, body).(map[string]interface{})
+	if all := ret["all"].([]map[string]interface{}); len(all) != 5 {
+		t.Error(all)
+	}
+	expected := map[string]string{
+		"cheap": `[{"name":"Cable","price":"¥9.90","tag":"配件"},{"name":"Case","price":"¥19.90","tag":"配件"}]`,
+		"top":   `[{"name":"Laptop","price":"¥5,999.00","tag":"3C"},{"name":"Phone","price":"¥1,299.00","tag":"3C"}]`,
+		"page":  `[{"name":"Phone","price":"¥1,299.00","tag":"3C"},{"name":"Phone","price":"¥1,099.00","tag":"3C"}]`,
+	}
+	for key, want := range expected {
+		out, _ := json.Marshal(ret[key])
+		if string(out) != want {
+			t.Errorf("%s: %s", key, out)
+		}
+	}
+}
+
+func TestShapeJsonAndString(t *testing.T) {
+	config := `{"_type":"json", "_root":"data", "_where":{"score":">=60"}, "_sort":"score desc", "name":"name", "score":"score"}`
+	body := []byte(`{"data":[{"name":"a","score":59},{"name":"b","score":88},{"name":"c","score":60}]}`)
+	m := map[string]interface{}{}
+	json.Unmarshal([]byte(config), &m)
+	out, _ := json.Marshal(NewExtractor().Do(m, body))
+	if string(out) != `[{"name":"b","score":"88"},{"name":"c","score":"60"}]` {
+		t.Error(string(out))
+	}
+
+	config = `{"_type":"string", "_root":"id=\\d+", "_unique":true, "_limit":2, "id":"id=(\\d+)"}`
+	m = map[string]interface{}{}
+	json.Unmarshal([]byte(config), &m)
+	out, _ = json.Marshal(NewExtractor().Do(m, []byte("id=1 id=2 id=1 id=3")))
+	if string(out) != `[{"id":"1"},{"id":"2"}]` {
+		t.Error(string(out))
+	}
+}
+
+func TestCompareValues(t *testing.T) {
+	cases := []struct {
+		a, b interface{}
+		cmp  int
+	}{
+		{"A1", "B1", -1},
+		{"B1", "A1", 1},
+		{"SKU-1024", "SKU-1", 1},
+		{"SKU-1024", "-1024", 1},
+		{"1A", "1B", -1},
+		{"¥1,299.00", "¥999", 1},
+		{"¥1,299.00", "1299", 0},
+		{"12件", "3件", 1},
+		{"US$ 5", "5", 0},
+		{"1,2", "12", -1},
+		{"9", "10", -1},
+		{88.0, "60", 1},
+	}
+	for _, c := range cases {
+		if cmp := compareValues(c.a, c.b); cmp != c.cmp {
+			t.Errorf("compareValues(%v, %v) = %d", c.a, c.b, cmp)
+		}
+	}
+	for _, v := range []string{"A1", "SKU-1024", "1,2", "1.2.3", "12 34", "v2"} {
+		if n, ok := toNumber(v); ok {
+			t.Errorf("%s read as %v", v, n)
+		}
+	}
+}
+
+func TestShapeSingleMatch(t *testing.T) {
+	body := []byte(`<html><body>
+		<ul class="one"><li><a>Phone</a><span>¥1,299.00</span></li></ul>
+		<dl><dt>品牌</dt><dd>Acme</dd><dt>型号</dt><dd>X1</dd></dl>
+		<dl><dt>品牌</dt><dd>Other</dd></dl>
+	</body></html>`)
+	config := `{
+		"kept":{"_root":"ul.one li", "_where":{"price":">1000"}, "name":"a", "price":"span"},
+		"dropped":{"_root":"ul.one li", "_where":{"price":"<1000"}, "name":"a", "price":"span"},
+		"pairs":{"_root":"dl", "_pairs":true, "_where":{"品牌":"Acme"}},
+		"sorted":{"_root":"li", "_sort":"sku str", "sku":"a"}
+	}`
+	m := map[string]interface{}{}
+	json.Unmarshal([]byte(config), &m)
+	out, _ := json.Marshal(NewExtractor().Do(m, body))
+	want := `{"dropped":[],"kept":[{"name":"Phone","price":"¥1,299.00"}],"pairs":[{"品牌":"Acme","型号":"X1"}],"sorted":[{"sku":"Phone"}]}`
+	if string(out) != want {
+		t.Error(string(out))
+	}
+
+	config = `{"_type":"json", "_root":"data", "_where":{"score":">=60"}, "name":"name", "score":"score"}`
+	m = map[string]interface{}{}
+	json.Unmarshal([]byte(config), &m)
+	out, _ = json.Marshal(NewExtractor().Do(m, []byte(`{"data":{"name":"a","score":59}}`)))
+	if string(out) != `[]` {
+		t.Error(string(out))
+	}
+}
@@ -0,0 +1,337 @@
+package extractor
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+)
+
+var (
+	spaceRegex    = regexp.MustCompile(`\s+`)
+	unstableRegex = regexp.MustCompile(`\d{2,}|[0-9a-f]{6,}|^(css|sc|jsx)-|__[A-Za-z0-9]{5}`)
+	numberRegex   = regexp.MustCompile(`^[\d.,]+$`)
+	suggestAttrs  = []string{"href", "src", "title", "alt", "content", "value", "data-src", "data-original"}
+)
+
+func normalizeSpace(s string) string {
+	return strings.TrimSpace(spaceRegex.ReplaceAllString(s, " "))
+}
+
+// stableName reports whether an id or class looks hand-written rather than
+// generated, e.g. "price" but not "item-2931" or "css-1x3fa9".
+func stableName(name string) bool {
+	return len(name) > 0 && !unstableRegex.MatchString(name)
+}
+
+func nodeAttr(n *html.Node, name string) string {
+	for _, a := range n.Attr {
+		if a.Key == name {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func stableClasses(n *html.Node) []string {
+	ret := []string{}
+	for _, class := range strings.Fields(nodeAttr(n, "class")) {
+		if stableName(class) {
+			ret = append(ret, class)
+		}
+	}
+	return ret
+}
+
+func selectorPart(n *html.Node) string {
+	part := n.Data
+	for _, class := range stableClasses(n) {
+		part += "." + class
+	}
+	return part
+}
+
+func isAncestor(ancestor, n *html.Node) bool {
+	for p := n.Parent; p != nil; p = p.Parent {
+		if p == ancestor {
+			return true
+		}
+	}
+	return false
+}
+
+type valueMatch struct {
+	node  *html.Node
+	attr  string
+	regex string
+}
+
+// selector formats the match as a selector, backquoting the segments that
+// would not read back, such as a regex holding a ";".
+func (self *valueMatch) selector(path string) string {
+	ast := &SelectorAST{Path: &SelectorPart{Text: path}}
+	if len(self.attr) > 0 || len(self.regex) > 0 {
+		ast.Attr = &SelectorPart{Text: self.attr}
+	}
+	if len(self.regex) > 0 {
+		ast.Regex = &SelectorPart{Text: self.regex}
+	}
+	return ast.String()
+}
+
+// spacePattern quotes s for a regex in which any run of spaces matches any
+// other.
+func spacePattern(s string) string {
+	return spaceRegex.ReplaceAllString(regexp.QuoteMeta(s), `\s+`)
+}
+
+// findValue locates the innermost node under scope showing value, first as
+// its whole text, then as an attribute and last as part of its text.
+func findValue(scope *goquery.Selection, value string) *valueMatch {
+	value = normalizeSpace(value)
+	if len(value) == 0 {
+		return nil
+	}
+	nodes := scope.AddSelection(scope.Find("*"))
+	var exact, contains *html.Node
+	nodes.Each(func(i int, s *goquery.Selection) {
+		n := s.Get(0)
+		text := normalizeSpace(s.Text())
+		if text == value {
+			if exact == nil || isAncestor(exact, n) {
+				exact = n
+			}
+		} else if strings.Contains(text, value) {
+			if contains == nil || isAncestor(contains, n) {
+				contains = n
+			}
+		}
+	})
+	if exact != nil {
+		return &valueMatch{node: exact}
+	}
+
+	var attrMatch *valueMatch
+	nodes.EachWithBreak(func(i int, s *goquery.Selection) bool {
+		for _, name := range suggestAttrs {
+			val, ok := s.Attr(name)
+			if !ok {
+				continue
+			}
+			val = normalizeSpace(val)
+			if val == value || (strings.HasPrefix(val, "//") && "https:"+val == value) {
+				attrMatch = &valueMatch{node: s.Get(0), attr: name}
+				return false
+			}
+		}
+		return true
+	})
+	if attrMatch != nil {
+		return attrMatch
+	}
+
+	if contains != nil {
+		regex := `([\d.,]+)`
+		if !numberRegex.MatchString(value) {
+			// the regex runs on the trimmed text, spaces inside it as is
+			text := strings.TrimSpace(goquery.NewDocumentFromNode(contains).Text())
+			loc := regexp.MustCompile(spacePattern(value)).FindStringIndex(text)
+			regex = "^" + spacePattern(text[:loc[0]]) + "(.+?)" + spacePattern(text[loc[1]:]) + "$"
+		}
+		return &valueMatch{node: contains, regex: regex}
+	}
+	return nil
+}
+
+// cssPath builds the shortest selector, relative to scope, whose first
+// match is node. It prefers stable ids, then tags with stable classes, and
+// only falls back to @index when the structure is ambiguous.
+func cssPath(scope *goquery.Selection, node *html.Node) string {
+	if scope.Get(0) == node {
+		return ""
+	}
+	parts := []string{}
+	for n := node; n != nil && n != scope.Get(0); n = n.Parent {
+		if n.Type != html.ElementNode {
+			continue
+		}
+		if id := nodeAttr(n, "id"); stableName(id) {
+			parts = append([]string{"#" + id}, parts...)
+		} else {
+			parts = append([]string{selectorPart(n)}, parts...)
+		}
+		found := scope.Find(strings.Join(parts, " "))
+		if found.Size() == 1 && found.Get(0) == node {
+			return strings.Join(parts, " ")
+		}
+	}
+	sel := strings.Join(parts, " ")
+	found := scope.Find(sel)
+	if found.Size() > 0 && found.Get(0) == node {
+		return sel
+	}
+	index := 0
+	found.EachWithBreak(func(i int, s *goquery.Selection) bool {
+		if s.Get(0) == node {
+			index = i
+			return false
+		}
+		return true
+	})
+	return sel + " @index=" + strconv.Itoa(index)
+}
+
+// records finds the repeated elements holding the given nodes: the children
+// of their lowest common ancestor that contain them.
+func records(nodes []*html.Node) (*html.Node, []*html.Node) {
+	if len(nodes) < 2 {
+		return nil, nil
+	}
+	var lca *html.Node
+	for p := nodes[0].Parent; p != nil && lca == nil; p = p.Parent {
+		all := true
+		for _, n := range nodes[1:] {
+			if !isAncestor(p, n) {
+				all = false
+				break
+			}
+		}
+		if all {
+			lca = p
+		}
+	}
+	if lca == nil {
+		return nil, nil
+	}
+	ret := []*html.Node{}
+	for _, n := range nodes {
+		r := n
+		for r.Parent != lca {
+			r = r.Parent
+		}
+		for _, seen := range ret {
+			if seen == r {
+				return nil, nil
+			}
+		}
+		ret = append(ret, r)
+	}
+	return lca, ret
+}
+
+func recordSelector(doc *goquery.Selection, lca *html.Node, recs []*html.Node) string {
+	common := map[string]int{}
+	for _, r := range recs {
+		for _, class := range stableClasses(r) {
+			common[class]++
+		}
+	}
+	part := recs[0].Data
+	for _, class := range stableClasses(recs[0]) {
+		if common[class] == len(recs) {
+			part += "." + class
+		}
+	}
+	parent := cssPath(doc, lca)
+	if strings.Contains(parent, "@index") || len(parent) == 0 {
+		return part
+	}
+	return parent + " > " + part
+}
+
+func exampleValues(v interface{}) []string {
+	switch val := v.(type) {
+	case string:
+		return []string{val}
+	case []string:
+		return val
+	case []interface{}:
+		ret := []string{}
+		for _, sub := range val {
+			ret = append(ret, fmt.Sprint(sub))
+		}
+		return ret
+	}
+	return []string{fmt.Sprint(v)}
+}
+
+// Suggest proposes a config extracting the example values from body. A field
+// given several example values is treated as a list: its records are
+// detected and emitted as a _root with @array. The second result lists the
+// fields whose example could not be found.
+func Suggest(body []byte, examples map[string]interface{}) (map[string]interface{}, []string, error) {
+	d, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+	doc := d.First()
+	keys := []string{}
+	for key := range examples {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	config := map[string]interface{}{}
+	missing := []string{}
+	var list map[string]interface{}
+	var recordScope *goquery.Selection
+	for _, key := range keys {
+		values := exampleValues(examples[key])
+		if len(values) == 1 {
+			match := findValue(doc, values[0])
+			if match == nil {
+				missing = append(missing, key)
+				continue
+			}
+			config[key] = match.selector(cssPath(doc, match.node))
+			continue
+		}
+
+		if recordScope == nil {
+			nodes := []*html.Node{}
+			for _, value := range values {
+				if match := findValue(doc, value); match != nil {
+					nodes = append(nodes, match.node)
+				}
+			}
+			lca, recs := records(nodes)
+			if lca == nil {
+				missing = append(missing, key)
+				continue
+			}
+			recordScope = goquery.NewDocumentFromNode(recs[0]).Selection
+			list = map[string]interface{}{
+				ROOT_DEFINE: recordSelector(doc, lca, recs) + "@array",
+			}
+		}
+		found := false
+		for _, value := range values {
+			if match := findValue(recordScope, value); match != nil {
+				list[key] = match.selector(cssPath(recordScope, match.node))
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, key)
+		}
+	}
+
+	if list != nil {
+		if len(config) == 0 {
+			config = list
+		} else {
+			config["items"] = list
+		}
+	}
+	if len(config) == 0 {
+		return nil, missing, errors.New("no example value found")
+	}
+	return config, missing, nil
+}
@@ -0,0 +1,51 @@
+package extractor
+
+import (
+	"testing"
+)
+
+func TestSuggest(t *testing.T) {
+	data := []byte(`<html><body>
+	<div id="main"><h1 class="title css-1x3fa9">Phone X</h1><p class="price">Price: ¥199.00</p></div>
+	<ul class="result">
+		<li class="item item-2931"><a href="/p/1">First</a><span class="num">10</span></li>
+		<li class="item item-2932"><a href="/p/2">Second</a><span class="num">20</span></li>
+		<li class="item item-2933"><a href="/p/3">Third</a><span class="num">30</span></li>
+	</ul>
+	</body></html>`)
+	examples := map[string]interface{}{
+		"title": "Phone X",
+		"price": "199.00",
+		"name":  []interface{}{"First", "Second"},
+		"link":  []interface{}{"/p/1", "/p/2"},
+	}
+	config, missing, err := Suggest(data, examples)
+	if err != nil || len(missing) > 0 {
+		t.Fatal(err, missing)
+	}
+	t.Log(config)
+
+	ret := NewExtractor().Do(config, data).(map[string]interface{})
+	if ret["title"] != "Phone X" || ret["price"] != "199.00" {
+		t.Error(ret)
+	}
+	items := ret["items"].([]map[string]interface{})
+	if len(items) != 3 || items[2]["name"] != "Third" || items[1]["link"] != "/p/2" {
+		t.Error(items)
+	}
+}
+
+func TestSuggestQuotedRegex(t *testing.T) {
+	data := []byte(`<html><body><p class="t">Name:   Phone;  new  </p></body></html>`)
+	config, missing, err := Suggest(data, map[string]interface{}{"name": "Phone"})
+	if err != nil || len(missing) > 0 {
+		t.Fatal(err, missing)
+	}
+	if _, err := ParseSelector(config["name"].(string)); err != nil {
+		t.Fatal(err)
+	}
+	ret, err := NewExtractor().Parse(config, data)
+	if err != nil || ret.(map[string]interface{})["name"] != "Phone" {
+		t.Error(config, ret, err)
+	}
+}
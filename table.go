@@ -0,0 +1,244 @@
+package extractor
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+)
+
+var colRegex = regexp.MustCompile(`^@col\(([^)]*)\)\s*`)
+
+type tableCell struct {
+	sel  *goquery.Selection
+	text string
+}
+
+type table struct {
+	headers []string
+	rows    [][]*tableCell
+	nodes   []*goquery.Selection
+}
+
+// ownRows returns the rows of t without those of nested tables.
+func ownRows(t *goquery.Selection) []*goquery.Selection {
+	rows := []*goquery.Selection{}
+	node := t.Get(0)
+	t.Find("tr").Each(func(i int, tr *goquery.Selection) {
+		if tr.Closest("table").Get(0) == node {
+			rows = append(rows, tr)
+		}
+	})
+	return rows
+}
+
+func spanAttr(s *goquery.Selection, name string) int {
+	v, ok := s.Attr(name)
+	if !ok {
+		return 1
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(v))
+	if err != nil || n < 1 {
+		return 1
+	}
+	if n > 1000 {
+		return 1000
+	}
+	return n
+}
+
+// buildGrid lays the cells of rows out on a grid, repeating cells spanning
+// several rows or columns in every position they cover.
+func buildGrid(rows []*goquery.Selection) [][]*tableCell {
+	grid := make([][]*tableCell, len(rows))
+	for r, tr := range rows {
+		col := 0
+		tr.Children().Each(func(i int, c *goquery.Selection) {
+			if c.Get(0).Type != html.ElementNode || (c.Get(0).Data != "td" && c.Get(0).Data != "th") {
+				return
+			}
+			for col < len(grid[r]) && grid[r][col] != nil {
+				col++
+			}
+			cell := &tableCell{sel: c, text: normalizeSpace(c.Text())}
+			rowspan, colspan := spanAttr(c, "rowspan"), spanAttr(c, "colspan")
+			for dr := 0; dr < rowspan && r+dr < len(rows); dr++ {
+				for dc := 0; dc < colspan; dc++ {
+					for len(grid[r+dr]) <= col+dc {
+						grid[r+dr] = append(grid[r+dr], nil)
+					}
+					grid[r+dr][col+dc] = cell
+				}
+			}
+			col += colspan
+		})
+	}
+	return grid
+}
+
+func headerRowCount(rows []*goquery.Selection, m map[string]interface{}) int {
+	if n, ok := m[HEADER_ROWS_DEFINE].(float64); ok {
+		return int(n)
+	}
+	head := 0
+	for _, tr := range rows {
+		if tr.ParentsFiltered("thead").Size() > 0 {
+			head++
+		}
+	}
+	if head > 0 {
+		return head
+	}
+	return 1
+}
+
+func parseTable(t *goquery.Selection, m map[string]interface{}) *table {
+	rows := ownRows(t)
+	grid := buildGrid(rows)
+	headerRows := headerRowCount(rows, m)
+	if headerRows > len(grid) {
+		headerRows = len(grid)
+	}
+
+	ret := &table{}
+	width := 0
+	for _, row := range grid {
+		if len(row) > width {
+			width = len(row)
+		}
+	}
+	seen := map[string]int{}
+	for col := 0; col < width; col++ {
+		parts := []string{}
+		for r := 0; r < headerRows; r++ {
+			if col >= len(grid[r]) || grid[r][col] == nil || len(grid[r][col].text) == 0 {
+				continue
+			}
+			text := grid[r][col].text
+			if len(parts) == 0 || parts[len(parts)-1] != text {
+				parts = append(parts, text)
+			}
+		}
+		header := strings.Join(parts, "/")
+		if len(header) == 0 {
+			header = "col" + strconv.Itoa(col)
+		}
+		seen[header]++
+		if seen[header] > 1 {
+			header += "_" + strconv.Itoa(seen[header])
+		}
+		ret.headers = append(ret.headers, header)
+	}
+	for r := headerRows; r < len(grid); r++ {
+		row := make([]*tableCell, width)
+		copy(row, grid[r])
+		empty := true
+		for _, cell := range row {
+			if cell != nil && len(cell.text) > 0 {
+				empty = false
+			}
+		}
+		if empty {
+			continue
+		}
+		ret.rows = append(ret.rows, row)
+		ret.nodes = append(ret.nodes, rows[r])
+	}
+	return ret
+}
+
+// column finds a column by header text. A header of a multi-row header
+// matches by its full path or by its last part; a number selects by index.
+func (self *table) column(name string) int {
+	for i, header := range self.headers {
+		if header == name {
+			return i
+		}
+	}
+	for i, header := range self.headers {
+		if strings.HasSuffix(header, "/"+name) {
+			return i
+		}
+	}
+	if index, err := strconv.Atoi(name); err == nil && index >= 0 && index < len(self.headers) {
+		return index
+	}
+	return -1
+}
+
+func (self *Extractor) tableField(t *table, r int, val interface{}) interface{} {
+	v, ok := val.(string)
+	if !ok {
+		return self.extract(val, t.nodes[r])
+	}
+	if group := colRegex.FindStringSubmatch(v); group != nil {
+		col := t.column(group[1])
+		if col < 0 || t.rows[r][col] == nil {
+			return nil
+		}
+		rest := v[len(group[0]):]
+		if len(rest) == 0 {
+			return nilIfEmpty(t.rows[r][col].text)
+		}
+		return self.extract(rest, t.rows[r][col].sel)
+	}
+	return self.extract(v, t.nodes[r])
+}
+
+func nilIfEmpty(s string) interface{} {
+	if len(s) == 0 {
+		return nil
+	}
+	return s
+}
+
+// tableRecord extracts one body row as a record, followed by its _computed
+// fields.
+func (self *Extractor) tableRecord(m map[string]interface{}, tbl *table, r int, row []*tableCell) map[string]interface{} {
+	record := make(map[string]interface{})
+	defer self.enterRecord(m, record)()
+	if isEmptyParse(m) {
+		for col, header := range tbl.headers {
+			if row[col] != nil {
+				record[header] = nilIfEmpty(row[col].text)
+			} else {
+				record[header] = nil
+			}
+		}
+	} else {
+		for _, key := range nestedLast(m) {
+			if strings.HasPrefix(key, "_") {
+				continue
+			}
+			leave := self.traceEnter(key)
+			record[key] = self.tableField(tbl, r, m[key])
+			leave()
+		}
+	}
+	self.computeFields()
+	return record
+}
+
+// extractTable turns the table found at s into one record per body row.
+// Without fields the records are keyed by header text; a field names its
+// column by @col(header) followed by an optional selector applied to the
+// cell, or is a plain selector applied to the row.
+func (self *Extractor) extractTable(m map[string]interface{}, s *goquery.Selection) []map[string]interface{} {
+	t := s.First()
+	if goquery.NodeName(t) != "table" {
+		t = t.Find("table").First()
+	}
+	ret := []map[string]interface{}{}
+	if t.Size() == 0 {
+		return ret
+	}
+	tbl := parseTable(t, m)
+	for r, row := range tbl.rows {
+		leave := self.traceEnter("[" + strconv.Itoa(r) + "]")
+		ret = append(ret, self.tableRecord(m, tbl, r, row))
+		leave()
+	}
+	return ret
+}
@@ -0,0 +1,61 @@
+package extractor
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+var tablePage = []byte(`<html><body>
+	<table id="list">
+		<thead>
+			<tr><th rowspan="2">期数</th><th colspan="2">还款</th><th rowspan="2">状态</th></tr>
+			<tr><th>还款日期</th><th>还款金额</th></tr>
+		</thead>
+		<tbody>
+			<tr><td>1</td><td>2026-01-01</td><td>100.00</td><td rowspan="2">已还</td></tr>
+			<tr><td>2</td><td>2026-02-01</td><td>200.00</td></tr>
+			<tr><td>3</td><td colspan="2">逾期</td><td><a href="/detail/3">未还</a></td></tr>
+		</tbody>
+	</table>
+	</body></html>`)
+
+func TestExtractTable(t *testing.T) {
+	config := `{"_root":"table#list", "_table":true}`
+	m := map[string]interface{}{}
+	json.Unmarshal([]byte(config), &m)
+	ret := NewExtractor().Do(m, tablePage).([]map[string]interface{})
+	if len(ret) != 3 || ret[1]["还款/还款金额"] != "200.00" || ret[1]["状态"] != "已还" || ret[2]["还款/还款日期"] != "逾期" {
+		t.Error(ret)
+	}
+	t.Log(ret)
+}
+
+func TestExtractTableFields(t *testing.T) {
+	config := `{"_root":"table#list", "_table":true, "amount":"@col(还款金额)", "no":"@col(期数)", "first":"td", "link":"@col(状态) a;href"}`
+	m := map[string]interface{}{}
+	json.Unmarshal([]byte(config), &m)
+	ret := NewExtractor().Do(m, tablePage).([]map[string]interface{})
+	if len(ret) != 3 || ret[0]["amount"] != "100.00" || ret[2]["no"] != "3" || ret[2]["first"] != "3" || ret[2]["link"] != "/detail/3" || ret[0]["link"] != nil {
+		t.Error(ret)
+	}
+	t.Log(ret)
+}
+
+func TestExtractTableComputed(t *testing.T) {
+	config := `{"_root":"table#list", "_table":true, "no":"@col(期数)", "amount":"@col(还款金额)", "_computed":{"double":"amount * 2", "label":"concat(no, \":\", 状态)"}}`
+	m := map[string]interface{}{}
+	json.Unmarshal([]byte(config), &m)
+	out, _ := json.Marshal(NewExtractor().Do(m, tablePage))
+	expected := `[{"amount":"100.00","double":200,"label":"1:","no":"1"},{"amount":"200.00","double":400,"label":"2:","no":"2"},{"amount":"逾期","double":null,"label":"3:","no":"3"}]`
+	if string(out) != expected {
+		t.Error(string(out))
+	}
+
+	config = `{"_root":"table#list", "_table":true, "_computed":{"paid":"状态 == \"已还\""}}`
+	m = map[string]interface{}{}
+	json.Unmarshal([]byte(config), &m)
+	ret := NewExtractor().Do(m, tablePage).([]map[string]interface{})
+	if len(ret) != 3 || ret[1]["paid"] != true || ret[2]["paid"] != false {
+		t.Error(ret)
+	}
+}
@@ -0,0 +1,207 @@
+package extractor
+
+import (
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/bitly/go-simplejson"
+)
+
+const traceSnippetLength = 200
+
+type TraceStep struct {
+	Step    string `json:"step"`
+	Matched int    `json:"matched"`
+}
+
+// Trace records how one field was resolved. The trace of a config is a tree
+// with one child per field and one child per record of an array.
+type Trace struct {
+	Field       string        `json:"field"`
+	Root        string        `json:"root,omitempty"`
+	RootMatched int           `json:"root_matched,omitempty"`
+	Selector    string        `json:"selector,omitempty"`
+	Matched     int           `json:"matched"`
+	Snippet     string        `json:"snippet,omitempty"`
+	Raw         interface{}   `json:"raw,omitempty"`
+	Regex       string        `json:"regex,omitempty"`
+	RegexResult interface{}   `json:"regex_result,omitempty"`
+	Value       interface{}   `json:"value,omitempty"`
+	Steps       []TraceStep   `json:"steps,omitempty"`
+	Error       string        `json:"error,omitempty"`
+	Duration    time.Duration `json:"duration"`
+	Children    []*Trace      `json:"children,omitempty"`
+}
+
+// DoTrace works like Do and additionally returns the trace of every field.
+func (self *Extractor) DoTrace(config interface{}, body []byte) (interface{}, *Trace) {
+	ex := *self
+	ex.trace = &Trace{Field: "$"}
+	start := time.Now()
+	ret, err := ex.Parse(config, body)
+	if err != nil {
+		ex.trace.Error = err.Error()
+	}
+	ex.trace.Value = ret
+	ex.trace.Duration = time.Since(start)
+	return ret, ex.trace
+}
+
+// truncate cuts s to at most length bytes without splitting a character.
+func truncate(s string, length int) string {
+	if len(s) <= length {
+		return s
+	}
+	for length > 0 && !utf8.RuneStart(s[length]) {
+		length--
+	}
+	return s[:length] + "......"
+}
+
+func (self *Extractor) traceEnter(field string) func() {
+	if self.trace == nil {
+		return func() {}
+	}
+	parent := self.trace
+	child := &Trace{Field: field}
+	parent.Children = append(parent.Children, child)
+	self.trace = child
+	start := time.Now()
+	return func() {
+		child.Duration = time.Since(start)
+		self.trace = parent
+	}
+}
+
+func (self *Extractor) traceRoot(root string, matched int) {
+	if self.trace == nil {
+		return
+	}
+	self.trace.Root = root
+	self.trace.RootMatched = matched
+}
+
+func (self *Extractor) traceSelector(selector string, matched int) {
+	if self.trace == nil {
+		return
+	}
+	self.trace.Selector = selector
+	self.trace.Matched = matched
+}
+
+func (self *Extractor) traceHtml(b *goquery.Selection) {
+	if self.trace == nil || b == nil || b.Size() == 0 {
+		return
+	}
+	html, err := goquery.OuterHtml(b.First())
+	if err == nil {
+		self.trace.Snippet = truncate(html, traceSnippetLength)
+	}
+}
+
+func (self *Extractor) traceJson(json *simplejson.Json) {
+	if self.trace == nil || json == nil {
+		return
+	}
+	if data, err := json.Encode(); err == nil {
+		self.trace.Snippet = truncate(string(data), traceSnippetLength)
+	}
+}
+
+func (self *Extractor) traceRaw(raw interface{}) {
+	if self.trace == nil {
+		return
+	}
+	if str, ok := raw.(string); ok {
+		raw = truncate(str, traceSnippetLength)
+	}
+	self.trace.Raw = raw
+}
+
+func (self *Extractor) traceRegex(regex string, ret interface{}) {
+	if self.trace == nil || len(regex) == 0 {
+		return
+	}
+	self.trace.Regex = regex
+	self.trace.RegexResult = ret
+}
+
+func (self *Extractor) traceError(msg string) {
+	if self.trace == nil {
+		return
+	}
+	self.trace.Error = msg
+}
+
+func (self *Extractor) traceValue(v interface{}) {
+	if self.trace == nil {
+		return
+	}
+	if str, ok := v.(string); ok {
+		v = truncate(str, traceSnippetLength)
+	}
+	self.trace.Value = v
+}
+
+// traceHtmlSteps records how far a css selector that matched nothing still
+// matched, by evaluating ever longer prefixes of it and then each step of
+// its navigation chain.
+func (self *Extractor) traceHtmlSteps(xpath string, s *goquery.Selection) {
+	if self.trace == nil {
+		return
+	}
+	base, navs, err := parseXpath(xpath)
+	if err != nil {
+		self.trace.Error = err.Error()
+		return
+	}
+	b := s
+	tks := strings.Fields(base)
+	for i := range tks {
+		step := strings.Join(tks[:i+1], " ")
+		b = queryXpath(step, s)
+		if !self.traceStep(step, b) {
+			return
+		}
+	}
+	for _, nav := range navs {
+		if b, err = nav.apply(b); err != nil {
+			self.trace.Error = err.Error()
+			return
+		}
+		base = strings.TrimSpace(base + " " + nav.String())
+		if !self.traceStep(base, b) {
+			return
+		}
+	}
+}
+
+func (self *Extractor) traceStep(step string, b *goquery.Selection) bool {
+	matched := 0
+	if b != nil {
+		matched = b.Size()
+	}
+	self.trace.Steps = append(self.trace.Steps, TraceStep{Step: step, Matched: matched})
+	return matched > 0
+}
+
+// traceJsonSteps records the deepest prefix of a json path that still
+// resolved.
+func (self *Extractor) traceJsonSteps(jsonKey string, json *simplejson.Json) {
+	if self.trace == nil {
+		return
+	}
+	path := strings.Split(jsonKey, ".")
+	for i := range path {
+		matched := 0
+		if getJsonPath(path[:i+1], json) != nil {
+			matched = 1
+		}
+		self.trace.Steps = append(self.trace.Steps, TraceStep{Step: strings.Join(path[:i+1], "."), Matched: matched})
+		if matched == 0 {
+			break
+		}
+	}
+}
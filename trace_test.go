@@ -0,0 +1,69 @@
+package extractor
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestDoTrace(t *testing.T) {
+	extractor := NewExtractor()
+	config := `
+				{
+                    "title":"h1",
+                    "price":"div.price span.num;;([\\d.]+)",
+                    "items":{"_root":"li@array", "name":""}
+                }
+	`
+	data := []byte(`<html><body><h1>item</h1><div class="price"><span>¥199.00</span></div><ul><li>a</li><li>b</li></ul></body></html>`)
+	m := map[string]interface{}{}
+	json.Unmarshal([]byte(config), &m)
+	_, trace := extractor.DoTrace(m, data)
+	fields := map[string]*Trace{}
+	for _, child := range trace.Children {
+		fields[child.Field] = child
+	}
+	if fields["title"].Matched != 1 || fields["title"].Raw != "item" {
+		t.Error(fields["title"])
+	}
+	price := fields["price"]
+	if price.Matched != 0 || len(price.Steps) != 2 || price.Steps[0].Matched != 1 || price.Steps[1].Matched != 0 {
+		t.Error(price)
+	}
+	if fields["items"].RootMatched != 2 || len(fields["items"].Children) != 2 {
+		t.Error(fields["items"])
+	}
+	out, _ := json.Marshal(trace)
+	t.Log(string(out))
+}
+
+func TestTruncate(t *testing.T) {
+	cases := []struct {
+		s      string
+		length int
+		ret    string
+	}{
+		{"abc", 5, "abc"},
+		{"abcdef", 3, "abc......"},
+		{"中文字", 4, "中......"},
+		{"中文字", 6, "中文......"},
+		{"中文字", 2, "......"},
+	}
+	for _, c := range cases {
+		ret := truncate(c.s, c.length)
+		if ret != c.ret || !utf8.ValidString(ret) {
+			t.Errorf("truncate(%q, %d) = %q", c.s, c.length, ret)
+		}
+	}
+}
+
+func TestTraceJsonSnippet(t *testing.T) {
+	config := map[string]interface{}{"_type": "json", "title": "data.title"}
+	data := []byte(`{"data":{"title":"` + strings.Repeat("中文标题", 40) + `"}}`)
+	_, trace := NewExtractor().DoTrace(config, data)
+	snippet := trace.Children[0].Snippet
+	if len(snippet) == 0 || len(snippet) > traceSnippetLength+len("......") || !utf8.ValidString(snippet) {
+		t.Errorf("%q", snippet)
+	}
+}